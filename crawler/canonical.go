@@ -0,0 +1,236 @@
+package crawler
+
+import (
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"strings"
+)
+
+// Canonicalization rules, as named in `ParseCanonicalConfig`
+const (
+	RuleFragment  = "fragment"
+	RuleCase      = "case"
+	RulePort      = "port"
+	RuleSortQuery = "sort-query"
+	RuleTracking  = "tracking"
+	RuleEncoding  = "encoding"
+	RulePath      = "path"
+)
+
+// CanonicalConfig tells which rules are applied to turn the urls found into their canonical form,
+// so the same page is not crawled once for every way of writing its url
+type CanonicalConfig struct {
+	// Drop the `#fragment`
+	StripFragment bool
+	// Lowercase the host, the scheme always is
+	LowercaseHost bool
+	// Drop `:80` from http urls and `:443` from https ones
+	RemoveDefaultPort bool
+	// Sort query params by name, keeping the order of repeated ones
+	SortQuery bool
+	// Query params to drop, a name ending with `*` drops every param starting with it
+	DropParams []string
+	// Decode percent-encoded unreserved characters and uppercase the remaining escapes
+	NormalizeEncoding bool
+	// Remove `.` and `..` segments and turn an empty path into `/`
+	NormalizePath bool
+}
+
+// ParseCanonicalConfig builds a `CanonicalConfig` from a comma separated list of `rules`, like `fragment,case`,
+// and a comma separated list of tracking `params`, dropped if the `tracking` rule is on
+func ParseCanonicalConfig(rules string, params string) (CanonicalConfig, error) {
+	cfg := CanonicalConfig{}
+	for _, r := range strings.Split(rules, ",") {
+		switch strings.TrimSpace(r) {
+		case "":
+		case RuleFragment:
+			cfg.StripFragment = true
+		case RuleCase:
+			cfg.LowercaseHost = true
+		case RulePort:
+			cfg.RemoveDefaultPort = true
+		case RuleSortQuery:
+			cfg.SortQuery = true
+		case RuleTracking:
+			cfg.DropParams = []string{}
+			for _, p := range strings.Split(params, ",") {
+				if p = strings.TrimSpace(p); p != "" {
+					cfg.DropParams = append(cfg.DropParams, p)
+				}
+			}
+		case RuleEncoding:
+			cfg.NormalizeEncoding = true
+		case RulePath:
+			cfg.NormalizePath = true
+		default:
+			return CanonicalConfig{}, fmt.Errorf("unknown canonicalization rule %s", strings.TrimSpace(r))
+		}
+	}
+	return cfg, nil
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// isUnreserved returns `true` for the characters that never need to be percent-encoded, see RFC 3986 section 2.3
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+// normalizeEscapes decodes the percent-encoded unreserved characters of `s` and uppercases the remaining escapes
+func normalizeEscapes(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' || i+2 >= len(s) || !isHex(s[i+1]) || !isHex(s[i+2]) {
+			b.WriteByte(s[i])
+			continue
+		}
+		if c := unhex(s[i+1])<<4 | unhex(s[i+2]); isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(s[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+// removeDotSegments resolves the `.` and `..` segments of `path`, see RFC 3986 section 5.2.4
+func removeDotSegments(path string) string {
+	if !strings.Contains(path, ".") {
+		return path
+	}
+	segments := strings.Split(path, "/")
+	out := []string{}
+	for i, s := range segments {
+		last := i == len(segments)-1
+		switch s {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			// The leading empty segment of absolute paths is never removed
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+// dropped returns `true` if the query param `name` matches any of `params`
+func dropped(name string, params []string) bool {
+	for _, p := range params {
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(name, strings.TrimSuffix(p, "*")) || name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalizeQuery applies the query rules of `cfg` to the `raw` query
+func canonicalizeQuery(raw string, cfg CanonicalConfig) string {
+	type param struct {
+		name string
+		raw  string
+	}
+	params := []param{}
+	for _, p := range strings.Split(raw, "&") {
+		if p == "" {
+			continue
+		}
+		name := p
+		if i := strings.Index(p, "="); i >= 0 {
+			name = p[:i]
+		}
+		if unescaped, err := neturl.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if dropped(name, cfg.DropParams) {
+			continue
+		}
+		if cfg.NormalizeEncoding {
+			p = normalizeEscapes(p)
+		}
+		params = append(params, param{name, p})
+	}
+	if cfg.SortQuery {
+		sort.SliceStable(params, func(i, j int) bool { return params[i].name < params[j].name })
+	}
+
+	query := make([]string, 0, len(params))
+	for _, p := range params {
+		query = append(query, p.raw)
+	}
+	return strings.Join(query, "&")
+}
+
+// Canonicalize returns the canonical form of `u` according to the crawler `Canonical` rules.
+// Urls that can't be parsed are returned as they are.
+func (c *Crawler) Canonicalize(u string) string {
+	cfg := c.Canonical
+	parsed, err := neturl.Parse(u)
+	if err != nil || parsed.Opaque != "" {
+		return u
+	}
+
+	if cfg.StripFragment {
+		parsed.Fragment = ""
+	}
+	if cfg.LowercaseHost {
+		parsed.Host = strings.ToLower(parsed.Host)
+	}
+	if cfg.RemoveDefaultPort {
+		if port := parsed.Port(); port == "" || port == defaultPorts[parsed.Scheme] {
+			parsed.Host = strings.TrimSuffix(strings.TrimSuffix(parsed.Host, ":"+port), ":")
+		}
+	}
+
+	if cfg.NormalizePath || cfg.NormalizeEncoding {
+		path := parsed.EscapedPath()
+		if cfg.NormalizeEncoding {
+			path = normalizeEscapes(path)
+		}
+		if cfg.NormalizePath {
+			path = removeDotSegments(path)
+			if path == "" && parsed.Host != "" {
+				path = "/"
+			}
+		}
+		if unescaped, err := neturl.PathUnescape(path); err == nil {
+			parsed.Path, parsed.RawPath = unescaped, path
+		}
+	}
+
+	if parsed.RawQuery != "" && (cfg.SortQuery || cfg.NormalizeEncoding || len(cfg.DropParams) > 0) {
+		parsed.RawQuery = canonicalizeQuery(parsed.RawQuery, cfg)
+	}
+	if parsed.RawQuery == "" {
+		parsed.ForceQuery = false
+	}
+	return parsed.String()
+}
@@ -0,0 +1,84 @@
+package crawler
+
+import (
+	"testing"
+
+	logr "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+var allRules = CanonicalConfig{
+	StripFragment:     true,
+	LowercaseHost:     true,
+	RemoveDefaultPort: true,
+	SortQuery:         true,
+	DropParams:        []string{"utm_*", "gclid"},
+	NormalizeEncoding: true,
+	NormalizePath:     true,
+}
+
+func TestCanonicalize(t *testing.T) {
+	testCases := []struct {
+		cfg      CanonicalConfig
+		url      string
+		expected string
+	}{
+		// Nothing is changed without rules
+		{CanonicalConfig{}, "HTTP://Example.com:80/a/../page?b=2&a=1#top", "http://Example.com:80/a/../page?b=2&a=1#top"},
+		{CanonicalConfig{StripFragment: true}, "https://example.com/page#top", "https://example.com/page"},
+		{CanonicalConfig{LowercaseHost: true}, "HTTPS://WWW.Example.COM/Page", "https://www.example.com/Page"},
+		{CanonicalConfig{RemoveDefaultPort: true}, "http://example.com:80/page", "http://example.com/page"},
+		{CanonicalConfig{RemoveDefaultPort: true}, "https://example.com:443/page", "https://example.com/page"},
+		{CanonicalConfig{RemoveDefaultPort: true}, "https://example.com:/page", "https://example.com/page"},
+		{CanonicalConfig{RemoveDefaultPort: true}, "http://example.com:443/page", "http://example.com:443/page"},
+		{CanonicalConfig{RemoveDefaultPort: true}, "https://example.com:8443/page", "https://example.com:8443/page"},
+		{CanonicalConfig{SortQuery: true}, "https://example.com/?b=2&a=1&b=1&c", "https://example.com/?a=1&b=2&b=1&c"},
+		{CanonicalConfig{DropParams: []string{"utm_*", "gclid"}}, "https://example.com/?utm_source=x&id=1&gclid=abc&utm_medium=y", "https://example.com/?id=1"},
+		{CanonicalConfig{DropParams: []string{"utm_*"}}, "https://example.com/page?utm_source=x", "https://example.com/page"},
+		{CanonicalConfig{NormalizeEncoding: true}, "https://example.com/%7euser/a%2fb%c3%a9?q=%41%2b", "https://example.com/~user/a%2Fb%C3%A9?q=A%2B"},
+		{CanonicalConfig{NormalizePath: true}, "https://example.com/a/./b/../c/", "https://example.com/a/c/"},
+		{CanonicalConfig{NormalizePath: true}, "https://example.com/a/b/..", "https://example.com/a/"},
+		{CanonicalConfig{NormalizePath: true}, "https://example.com/../../a", "https://example.com/a"},
+		{CanonicalConfig{NormalizePath: true}, "https://example.com", "https://example.com/"},
+		{CanonicalConfig{NormalizePath: true}, "https://example.com/v1.2/file.tar.gz", "https://example.com/v1.2/file.tar.gz"},
+		// Every way of writing the same page ends up the same
+		{allRules, "https://example.com/page", "https://example.com/page"},
+		{allRules, "https://example.com/page#top", "https://example.com/page"},
+		{allRules, "https://example.com/page?utm_source=x", "https://example.com/page"},
+		{allRules, "HTTPS://Example.com:443/docs/../page", "https://example.com/page"},
+		{allRules, "https://example.com/s?q=go&page=2&utm_campaign=z", "https://example.com/s?page=2&q=go"},
+		// Not http urls are left alone
+		{allRules, "mailto:Hello@Example.com", "mailto:Hello@Example.com"},
+	}
+
+	for _, tc := range testCases {
+		c := &Crawler{nil, new(logr.Logger), Config{Canonical: tc.cfg}}
+		assert.Equal(t, tc.expected, c.Canonicalize(tc.url), tc.url)
+	}
+}
+
+func TestCanonicalLinks(t *testing.T) {
+	c := &Crawler{nil, new(logr.Logger), Config{Scope: ScopeAll, Canonical: allRules}}
+	page := []byte(`<a href="/page">Page</a><a href="/page#top">Top</a><a href="/page?utm_source=x">Tracked</a>
+<a href="HTTP://Example.com:80/page">Shouting</a><a href="#comments">Comments</a>`)
+
+	links, _ := c.extractLinksFromPage("http://example.com/", "http://example.com/", page)
+	assert.Equal(t, []Link{{URL: "http://example.com/page", Text: "Page", Kind: KindAnchor}}, links)
+}
+
+func TestParseCanonicalConfig(t *testing.T) {
+	cfg, err := ParseCanonicalConfig("fragment,case,port,sort-query,tracking,encoding,path", "utm_*, gclid,")
+	assert.Nil(t, err)
+	assert.Equal(t, allRules, cfg)
+
+	cfg, err = ParseCanonicalConfig("fragment", "utm_*")
+	assert.Nil(t, err)
+	assert.Equal(t, CanonicalConfig{StripFragment: true}, cfg)
+
+	cfg, err = ParseCanonicalConfig("", "")
+	assert.Nil(t, err)
+	assert.Equal(t, CanonicalConfig{}, cfg)
+
+	_, err = ParseCanonicalConfig("fragment,www", "")
+	assert.EqualError(t, err, "unknown canonicalization rule www")
+}
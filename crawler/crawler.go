@@ -2,17 +2,106 @@ package crawler
 
 import (
 	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
 	neturl "net/url"
+	"regexp"
+	"strings"
 
 	"github.com/fcgravalos/wanna-crawl/fetcher"
 	logr "github.com/sirupsen/logrus"
 	"golang.org/x/net/html"
 )
 
+// Kinds of links, named after where they are found
+const (
+	KindAnchor  = "a"
+	KindArea    = "area"
+	KindLink    = "link"
+	KindImage   = "img"
+	KindScript  = "script"
+	KindIframe  = "iframe"
+	KindForm    = "form"
+	KindRefresh = "meta-refresh"
+	KindCSS     = "css"
+)
+
+// Kinds lists every kind of link the crawler can extract
+var Kinds = []string{KindAnchor, KindArea, KindLink, KindImage, KindScript, KindIframe, KindForm, KindRefresh, KindCSS}
+
+// ParseKinds parses a comma separated list of link kinds, like `a,img,script`
+func ParseKinds(list string) ([]string, error) {
+	kinds := []string{}
+	for _, k := range strings.Split(list, ",") {
+		k = strings.TrimSpace(k)
+		if k == "" {
+			continue
+		}
+		known := false
+		for _, kind := range Kinds {
+			known = known || k == kind
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown link kind %s", k)
+		}
+		kinds = append(kinds, k)
+	}
+	return kinds, nil
+}
+
 // Config represents crawler configuration
 type Config struct {
-	// Whether or not to follow external links on a scraped page
-	FollowExternalLinks bool
+	// Which links are extracted, one of `Scopes`, only those to the host of the page if empty
+	Scope string
+	// Hosts links can point to in the allowlist scope, `*.example.com` allowing any subdomain of `example.com`
+	AllowedHosts []string
+	// Whether links out of scope are extracted anyway, so they can be checked
+	ExtractOutOfScope bool
+	// Kinds of links to extract, only anchors if empty
+	Extract []string
+	// Rules turning the links found into their canonical form
+	Canonical CanonicalConfig
+	// Include and exclude rules links must pass
+	Rules Rules
+	// Whether `rel="nofollow"` links are marked as not to be followed
+	RespectRelNofollow bool
+	// Whether every link of pages with a nofollow directive, in a robots meta tag or an `X-Robots-Tag` header,
+	// is marked as not to be followed
+	RespectNofollow bool
+	// Whether pages with a noindex directive, in a robots meta tag or an `X-Robots-Tag` header, are marked as noindex
+	RespectNoindex bool
+}
+
+// Link is a reference to another url found in a page
+type Link struct {
+	// The absolute url
+	URL string
+	// Text of the anchor, with whitespace collapsed, or the alt text of images and areas
+	Text string
+	// Where the link was found, one of `Kinds`
+	Kind string
+	// Whether the link must not be followed, because of its `rel` or the directives of its page
+	Nofollow bool
+}
+
+// Result holds the outcome of crawling a single url
+type Result struct {
+	// What the fetcher got for the url
+	*fetcher.Response
+	// Links found in the page
+	Links []Link
+	// Whether the page asks not to be indexed
+	Noindex bool
+}
+
+// URLs returns the url of every link in the result
+func (r *Result) URLs() []string {
+	urls := make([]string, 0, len(r.Links))
+	for _, l := range r.Links {
+		urls = append(urls, l.URL)
+	}
+	return urls
 }
 
 // Crawler holds the crawler data structure
@@ -35,23 +124,124 @@ func (c *Crawler) normalizeURL(url string, link string) (string, error) {
 	return base.ResolveReference(u).String(), nil
 }
 
-func (c *Crawler) isInternal(urlA string, urlB string) bool {
-	a, err := neturl.Parse(urlA)
-	if err != nil {
-		return false
+// extracts returns `true` if links of `kind` must be extracted
+func (c *Crawler) extracts(kind string) bool {
+	if len(c.Extract) == 0 {
+		return kind == KindAnchor
+	}
+	for _, k := range c.Extract {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// cssURL matches CSS `url()` references, quoted or not
+var cssURL = regexp.MustCompile(`url\(\s*['"]?([^'")\s]+)['"]?\s*\)`)
+
+// cssURLs returns the urls referenced by the `css` stylesheet
+func cssURLs(css string) []string {
+	urls := []string{}
+	for _, m := range cssURL.FindAllStringSubmatch(css, -1) {
+		urls = append(urls, m[1])
 	}
+	return urls
+}
 
-	b, err := neturl.Parse(urlB)
-	if err != nil {
-		return false
+// srcsetURLs returns the urls of the image candidates in a `srcset` attribute, like `a.png 1x, b.png 2x`
+func srcsetURLs(srcset string) []string {
+	urls := []string{}
+	for _, candidate := range strings.Split(srcset, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
+
+// refreshURL returns the url of a `<meta http-equiv="refresh">` content, like `5; url=/next`, if any
+func refreshURL(content string) string {
+	i := strings.IndexAny(content, ";,")
+	if i < 0 {
+		return ""
+	}
+	rest := strings.TrimSpace(content[i+1:])
+	if len(rest) >= 3 && strings.EqualFold(rest[:3], "url") {
+		rest = strings.TrimSpace(rest[3:])
+		if !strings.HasPrefix(rest, "=") {
+			return ""
+		}
+		rest = strings.TrimSpace(rest[1:])
 	}
+	return strings.Trim(rest, `'"`)
+}
+
+// IsHTML returns `true` if `contentType` is an HTML media type, or unknown
+func IsHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
 
-	return a.Hostname() == b.Hostname()
+func attr(token html.Token, key string) (string, bool) {
+	for _, a := range token.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
 }
 
-func (c *Crawler) extractLinksFromPage(url string, page []byte) []string {
-	links := []string{}
-	extracted := map[string]bool{url: true} // Keep track of the already extracted links
+// extractLinksFromPage returns the links found in `page` along with the directives of its robots meta tags.
+// `url` is the requested url, links are in scope or not relative to it, and `servedFrom` where the page was
+// actually served from, after following redirects.
+func (c *Crawler) extractLinksFromPage(url string, servedFrom string, page []byte) ([]Link, directives) {
+	links := []Link{}
+	meta := directives{}
+	// Keep track of the already extracted links
+	extracted := map[string]bool{url: true, c.Canonicalize(url): true, servedFrom: true, c.Canonicalize(servedFrom): true}
+
+	// Relative links are resolved against the first `<base href>`, if any, and the page url otherwise
+	base, hasBase := servedFrom, false
+
+	// add appends the `link` of `kind` found in the page and returns its index, or -1 if it is discarded
+	add := func(link string, kind string, text string) int {
+		if !c.extracts(kind) {
+			return -1
+		}
+		l, err := c.normalizeURL(base, strings.TrimSpace(link))
+		if err != nil {
+			c.Warnf("malformed url %s", link)
+			return -1
+		}
+		l = c.Canonicalize(l)
+		if extracted[l] {
+			// If the same link is present in the page, ignore it
+			return -1
+		} else if !strings.HasPrefix(l, "http://") && !strings.HasPrefix(l, "https://") {
+			// mailto:, javascript:, data: and friends can't be crawled
+			c.Debugf("discarding %s as it's not an http url", l)
+			return -1
+		} else if !c.ExtractOutOfScope && !c.InScope(url, l) {
+			c.Debugf("discarding %s as it's out of scope", l)
+			return -1
+		} else if !c.Rules.Allowed(l) {
+			c.Debugf("discarding %s as it's excluded by the rules", l)
+			return -1
+		}
+		extracted[l] = true
+		links = append(links, Link{URL: l, Text: text, Kind: kind})
+		return len(links) - 1
+	}
+
+	// Index of the link whose anchor text is being read, -1 if none
+	anchor := -1
+	var text strings.Builder
+	// Whether a `<style>` element is being read
+	inStyle := false
 
 	r := bytes.NewReader(page)
 	it := html.NewTokenizer(r)
@@ -60,42 +250,164 @@ func (c *Crawler) extractLinksFromPage(url string, page []byte) []string {
 		token := it.Next()
 
 		switch {
-		case token == html.StartTagToken:
+		case token == html.TextToken && inStyle:
+			for _, u := range cssURLs(string(it.Text())) {
+				add(u, KindCSS, "")
+			}
+		case token == html.TextToken && anchor >= 0:
+			text.Write(it.Text())
+		case token == html.EndTagToken:
+			name, _ := it.TagName()
+			switch string(name) {
+			case "a":
+				if anchor >= 0 {
+					links[anchor].Text = strings.Join(strings.Fields(text.String()), " ")
+					anchor = -1
+				}
+			case "style":
+				inStyle = false
+			}
+		case token == html.StartTagToken || token == html.SelfClosingTagToken:
 			token := it.Token()
-			if token.Data == "a" {
+			if style, ok := attr(token, "style"); ok {
+				for _, u := range cssURLs(style) {
+					add(u, KindCSS, "")
+				}
+			}
+			alt, _ := attr(token, "alt")
+			rel, _ := attr(token, "rel")
+			switch token.Data {
+			case "base":
+				if href, ok := attr(token, "href"); ok && !hasBase {
+					hasBase = true
+					if b, err := c.normalizeURL(servedFrom, strings.TrimSpace(href)); err == nil {
+						base = b
+					} else {
+						c.Warnf("malformed base url %s", href)
+					}
+				}
+			case "a":
 				// found anchor tag, find href attr
-				for _, attr := range token.Attr {
-					if attr.Key == "href" {
-						l, err := c.normalizeURL(url, attr.Val)
-						if err != nil {
-							c.Warnf("malformed url %s", l)
-							continue
-						} else if extracted[l] {
-							// If the same link is present in the page, ignore it
-							continue
-						} else if !c.FollowExternalLinks && !c.isInternal(url, l) {
-							c.Debugf("discarding %s as it's an external link", l)
-							continue
-						}
-						extracted[l] = true
-						links = append(links, l)
+				if href, ok := attr(token, "href"); ok {
+					i := add(href, KindAnchor, "")
+					if i >= 0 && c.RespectRelNofollow && relNofollow(rel) {
+						links[i].Nofollow = true
+					}
+					if i >= 0 && token.Type == html.StartTagToken {
+						anchor = i
+						text.Reset()
+					}
+				}
+			case "area":
+				if href, ok := attr(token, "href"); ok {
+					if i := add(href, KindArea, alt); i >= 0 && c.RespectRelNofollow && relNofollow(rel) {
+						links[i].Nofollow = true
+					}
+				}
+			case "link":
+				if href, ok := attr(token, "href"); ok {
+					add(href, KindLink, "")
+				}
+			case "img":
+				if src, ok := attr(token, "src"); ok {
+					add(src, KindImage, alt)
+				}
+				if srcset, ok := attr(token, "srcset"); ok {
+					for _, u := range srcsetURLs(srcset) {
+						add(u, KindImage, alt)
 					}
 				}
+			case "script":
+				if src, ok := attr(token, "src"); ok {
+					add(src, KindScript, "")
+				}
+			case "iframe":
+				if src, ok := attr(token, "src"); ok {
+					add(src, KindIframe, "")
+				}
+			case "form":
+				if action, ok := attr(token, "action"); ok {
+					add(action, KindForm, "")
+				}
+			case "meta":
+				if name, _ := attr(token, "name"); strings.EqualFold(name, "robots") {
+					content, _ := attr(token, "content")
+					meta = meta.merge(parseDirectives(content))
+				}
+				if equiv, _ := attr(token, "http-equiv"); strings.EqualFold(equiv, "refresh") {
+					content, _ := attr(token, "content")
+					if u := refreshURL(content); u != "" {
+						add(u, KindRefresh, "")
+					}
+				}
+			case "style":
+				inStyle = token.Type == html.StartTagToken
 			}
 		case token == html.ErrorToken:
-			return links
+			return links, meta
 		}
 	}
 }
 
-// Crawl receivers a string `url` and it will return the links ([]string) found
-func (c *Crawler) Crawl(url string) ([]string, error) {
-	page, err := c.Fetch(url)
+// Crawl receives a string `url` and it will return the fetched response and the links found.
+// Non 2xx responses are returned along with an error and their body is not parsed, neither are non HTML
+// bodies nor those the fetcher skipped.
+func (c *Crawler) Crawl(url string) (*Result, error) {
+	resp, err := c.Fetch(url)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.extractLinksFromPage(url, page), nil
+	result := &Result{Response: resp}
+	if !resp.OK() {
+		return result, fmt.Errorf("%s returned status code %d", url, resp.StatusCode)
+	}
+	if resp.Skipped != "" {
+		c.Debugf("not parsing %s: %s", url, resp.Skipped)
+		return result, nil
+	}
+	if !IsHTML(resp.ContentType) {
+		c.Debugf("not parsing %s as it's %s", url, resp.ContentType)
+		result.Links = []Link{}
+		return result, nil
+	}
+
+	// Relative links are resolved against the url the page was actually served from, but a redirect to
+	// another host doesn't widen the scope
+	servedFrom := url
+	if resp.FinalURL != "" {
+		servedFrom = resp.FinalURL
+	}
+	links, meta := c.extractLinksFromPage(url, servedFrom, resp.Body)
+	d := meta.merge(headerDirectives(resp.Header))
+	if c.RespectNofollow && d.nofollow {
+		c.Debugf("not following the links of %s as it's nofollow", url)
+		for i := range links {
+			links[i].Nofollow = true
+		}
+	}
+	result.Links = links
+	result.Noindex = c.RespectNoindex && d.noindex
+	return result, nil
+}
+
+// Check requests `url` only to learn its status, without downloading nor parsing its body.
+// Servers not supporting HEAD requests get a GET one. Non 2xx responses are returned along with an error.
+func (c *Crawler) Check(url string) (*Result, error) {
+	resp, err := c.Head(url)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		c.Debugf("%s does not support HEAD requests, sending a GET one", url)
+		resp, err = c.Fetch(url)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Response: resp}
+	if !resp.OK() {
+		return result, fmt.Errorf("%s returned status code %d", url, resp.StatusCode)
+	}
+	return result, nil
 }
 
 // NewCrawler builds a `Crawler` object
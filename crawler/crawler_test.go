@@ -1,8 +1,10 @@
 package crawler
 
 import (
+	"fmt"
 	"testing"
 
+	"github.com/fcgravalos/wanna-crawl/fetcher"
 	logr "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -23,10 +25,51 @@ const fakeResponse = `
 </body>
 </html>`
 
+const kindsPage = `
+<html>
+<head>
+<meta http-equiv="Refresh" content="30; URL='/next'">
+<link rel="stylesheet" href="/style.css">
+<style>
+body { background: url("/bg.png"); }
+@font-face { src: url(https://fonts.example.com/font.woff); }
+</style>
+<script src="https://cdn.example.com/app.js"></script>
+</head>
+<body>
+<div style="background-image: url('/hero.png')">
+<a href="/about-us">About us</a>
+<a href="mailto:hello@wanna-crawl.com">Mail us</a>
+<img src="/logo.png" srcset="/logo.png 1x, /logo-2x.png 2x" alt="Logo"/>
+<img src="data:image/gif;base64,R0lGODlhAQABAAAAACw=">
+<map><area href="/map/north" alt="North"></map>
+<iframe src="https://video.example.com/embed/1"></iframe>
+<form action="/search"><input name="q"></form>
+</div>
+</body>
+</html>`
+
 type testFetcher struct{}
 
-func (t *testFetcher) Fetch(url string) ([]byte, error) {
-	return []byte(fakeResponse), nil
+func (t *testFetcher) Fetch(url string) (*fetcher.Response, error) {
+	switch url {
+	case "https://wanna-crawl.com/missing":
+		return &fetcher.Response{URL: url, FinalURL: url, StatusCode: 404, Body: []byte(fakeResponse)}, nil
+	case "https://wanna-crawl.com/big.iso":
+		return &fetcher.Response{URL: url, FinalURL: url, StatusCode: 200, ContentType: "application/octet-stream", Skipped: "content type application/octet-stream is not allowed"}, nil
+	case "https://wanna-crawl.com/doc.pdf":
+		return &fetcher.Response{URL: url, FinalURL: url, StatusCode: 200, ContentType: "application/pdf", Body: []byte(fakeResponse)}, nil
+	}
+	return &fetcher.Response{URL: url, FinalURL: url, StatusCode: 200, Body: []byte(fakeResponse)}, nil
+}
+
+func (t *testFetcher) Head(url string) (*fetcher.Response, error) {
+	if url == "https://wanna-crawl.com/no-head" {
+		return &fetcher.Response{URL: url, FinalURL: url, StatusCode: 405}, nil
+	}
+	resp, err := t.Fetch(url)
+	resp.Body = nil
+	return resp, err
 }
 
 func TestNormalizeURL(t *testing.T) {
@@ -37,12 +80,12 @@ func TestNormalizeURL(t *testing.T) {
 		expected string
 		err      bool
 	}{
-		{[]string{"https://wanna-crawl.com", "/about-us"}, "https://wanna-crawl.com/about-us", false},
-		{[]string{"https://wanna-crawl.com/", "/about-us"}, "https://wanna-crawl.com/about-us", false},
-		{[]string{"https://wanna-crawl.com/about-us", "/login"}, "https://wanna-crawl.com/login", false},
-		{[]string{"https://wanna-crawl.com/contact", "index.html"}, "https://wanna-crawl.com/index.html", false},
-		{[]string{"https://wanna-crawl.com/1/2/3/", ".index.html"}, "https://wanna-crawl.com/1/2/3/.index.html", false},
-		{[]string{"https://wanna-crawl.com/1/2/3/", "../index.html"}, "https://wanna-crawl.com/1/2/index.html", false},
+		{[]string{"https://wanna-crawl.com", "/about-us", KindAnchor}, "https://wanna-crawl.com/about-us", false},
+		{[]string{"https://wanna-crawl.com/", "/about-us", KindAnchor}, "https://wanna-crawl.com/about-us", false},
+		{[]string{"https://wanna-crawl.com/about-us", "/login", KindAnchor}, "https://wanna-crawl.com/login", false},
+		{[]string{"https://wanna-crawl.com/contact", "index.html", KindAnchor}, "https://wanna-crawl.com/index.html", false},
+		{[]string{"https://wanna-crawl.com/1/2/3/", ".index.html", KindAnchor}, "https://wanna-crawl.com/1/2/3/.index.html", false},
+		{[]string{"https://wanna-crawl.com/1/2/3/", "../index.html", KindAnchor}, "https://wanna-crawl.com/1/2/index.html", false},
 	}
 	for _, tc := range testCases {
 		failed := false
@@ -55,51 +98,191 @@ func TestNormalizeURL(t *testing.T) {
 	}
 }
 
-func TestIsInternal(t *testing.T) {
-	c := &Crawler{}
-	urlA := "https://wanna-crawl.com/"
-	urlB := "https://community.wanna-crawl.com/awesome"
-	urlC := "https://wanna-crawl.com/login"
-
-	assert.False(t, c.isInternal(urlA, urlB))
-	assert.True(t, c.isInternal(urlA, urlC))
-}
-
 func TestExtractLinksFromPage(t *testing.T) {
 	sampleHTML := []byte(fakeResponse)
 	testCases := []struct {
 		crawler       *Crawler
 		url           string
 		page          []byte
-		expectedLinks []string
+		expectedLinks []Link
 	}{
-		{&Crawler{nil, new(logr.Logger), Config{FollowExternalLinks: false}}, "https://wanna-crawl.com/", sampleHTML, []string{"https://wanna-crawl.com/login", "https://wanna-crawl.com/about-us", "https://wanna-crawl.com/index.html"}},
-		{&Crawler{nil, new(logr.Logger), Config{FollowExternalLinks: true}}, "https://wanna-crawl.com/", sampleHTML, []string{"https://wanna-crawl.com/login", "https://wanna-crawl.com/about-us", "https://wanna-crawl.com/index.html", "https://external.com/example"}},
+		{&Crawler{nil, new(logr.Logger), Config{Scope: ScopeHost}}, "https://wanna-crawl.com/", sampleHTML, []Link{{URL: "https://wanna-crawl.com/login", Text: "This is a link", Kind: KindAnchor}, {URL: "https://wanna-crawl.com/about-us", Text: "This is a relative link", Kind: KindAnchor}, {URL: "https://wanna-crawl.com/index.html", Text: "This is a link", Kind: KindAnchor}}},
+		{&Crawler{nil, new(logr.Logger), Config{Scope: ScopeAll}}, "https://wanna-crawl.com/", sampleHTML, []Link{{URL: "https://wanna-crawl.com/login", Text: "This is a link", Kind: KindAnchor}, {URL: "https://wanna-crawl.com/about-us", Text: "This is a relative link", Kind: KindAnchor}, {URL: "https://wanna-crawl.com/index.html", Text: "This is a link", Kind: KindAnchor}, {URL: "https://external.com/example", Text: "External link", Kind: KindAnchor}}},
+		{&Crawler{nil, new(logr.Logger), Config{Scope: ScopeAll}}, "https://wanna-crawl.com/", []byte(`<a href="/a"> Nested <b>anchor</b>
+		text </a><a href="/b"><img src="/logo.png"></a>`), []Link{{URL: "https://wanna-crawl.com/a", Text: "Nested anchor text", Kind: KindAnchor}, {URL: "https://wanna-crawl.com/b", Text: "", Kind: KindAnchor}}},
+		{&Crawler{nil, new(logr.Logger), Config{Scope: ScopeAll, Extract: Kinds}}, "https://wanna-crawl.com/", []byte(kindsPage), []Link{
+			{URL: "https://wanna-crawl.com/next", Text: "", Kind: KindRefresh},
+			{URL: "https://wanna-crawl.com/style.css", Text: "", Kind: KindLink},
+			{URL: "https://wanna-crawl.com/bg.png", Text: "", Kind: KindCSS},
+			{URL: "https://fonts.example.com/font.woff", Text: "", Kind: KindCSS},
+			{URL: "https://cdn.example.com/app.js", Text: "", Kind: KindScript},
+			{URL: "https://wanna-crawl.com/hero.png", Text: "", Kind: KindCSS},
+			{URL: "https://wanna-crawl.com/about-us", Text: "About us", Kind: KindAnchor},
+			{URL: "https://wanna-crawl.com/logo.png", Text: "Logo", Kind: KindImage},
+			{URL: "https://wanna-crawl.com/logo-2x.png", Text: "Logo", Kind: KindImage},
+			{URL: "https://wanna-crawl.com/map/north", Text: "North", Kind: KindArea},
+			{URL: "https://video.example.com/embed/1", Text: "", Kind: KindIframe},
+			{URL: "https://wanna-crawl.com/search", Text: "", Kind: KindForm},
+		}},
+		// Only the kinds asked for
+		{&Crawler{nil, new(logr.Logger), Config{Scope: ScopeHost, Extract: []string{KindImage, KindScript}}}, "https://wanna-crawl.com/", []byte(kindsPage), []Link{
+			{URL: "https://wanna-crawl.com/logo.png", Text: "Logo", Kind: KindImage},
+			{URL: "https://wanna-crawl.com/logo-2x.png", Text: "Logo", Kind: KindImage},
+		}},
 	}
 
 	for _, tc := range testCases {
 		c := tc.crawler
 		u := tc.url
 		p := tc.page
-		found := c.extractLinksFromPage(u, p)
+		found, _ := c.extractLinksFromPage(u, u, p)
 		assert.Equal(t, tc.expectedLinks, found)
 	}
 }
 
+func TestBaseHref(t *testing.T) {
+	c := &Crawler{nil, new(logr.Logger), Config{Scope: ScopeAll, Extract: Kinds}}
+	page := `<html><head>%s<link rel="stylesheet" href="css/site.css"></head>
+<body><a href="docs/intro.html">Intro</a><a href="/root">Root</a><a href="https://other.com/x">Other</a><img src="../logo.png"></body></html>`
+
+	testCases := []struct {
+		base     string
+		expected []string
+	}{
+		{
+			// No base, links are resolved against the page url
+			"",
+			[]string{"https://wanna-crawl.com/blog/css/site.css", "https://wanna-crawl.com/blog/docs/intro.html", "https://wanna-crawl.com/root", "https://other.com/x", "https://wanna-crawl.com/logo.png"},
+		},
+		{
+			`<base href="/static/v2/">`,
+			[]string{"https://wanna-crawl.com/static/v2/css/site.css", "https://wanna-crawl.com/static/v2/docs/intro.html", "https://wanna-crawl.com/root", "https://other.com/x", "https://wanna-crawl.com/static/logo.png"},
+		},
+		{
+			`<base href="../en/">`,
+			[]string{"https://wanna-crawl.com/en/css/site.css", "https://wanna-crawl.com/en/docs/intro.html", "https://wanna-crawl.com/root", "https://other.com/x", "https://wanna-crawl.com/logo.png"},
+		},
+		{
+			`<base href="https://cdn.wanna-crawl.com/assets/">`,
+			[]string{"https://cdn.wanna-crawl.com/assets/css/site.css", "https://cdn.wanna-crawl.com/assets/docs/intro.html", "https://cdn.wanna-crawl.com/root", "https://other.com/x", "https://cdn.wanna-crawl.com/logo.png"},
+		},
+		{
+			// Protocol relative, keeps the page scheme
+			`<base href="//mirror.wanna-crawl.com/site/">`,
+			[]string{"https://mirror.wanna-crawl.com/site/css/site.css", "https://mirror.wanna-crawl.com/site/docs/intro.html", "https://mirror.wanna-crawl.com/root", "https://other.com/x", "https://mirror.wanna-crawl.com/logo.png"},
+		},
+		{
+			// Only the first base counts, and one without href is ignored
+			`<base target="_blank"><base href="/first/"><base href="/second/">`,
+			[]string{"https://wanna-crawl.com/first/css/site.css", "https://wanna-crawl.com/first/docs/intro.html", "https://wanna-crawl.com/root", "https://other.com/x", "https://wanna-crawl.com/logo.png"},
+		},
+	}
+
+	for _, tc := range testCases {
+		links, _ := c.extractLinksFromPage("https://wanna-crawl.com/blog/post.html", "https://wanna-crawl.com/blog/post.html", []byte(fmt.Sprintf(page, tc.base)))
+		found := []string{}
+		for _, l := range links {
+			found = append(found, l.URL)
+		}
+		assert.Equal(t, tc.expected, found, tc.base)
+	}
+}
+
+func TestParseKinds(t *testing.T) {
+	kinds, err := ParseKinds("a, img,meta-refresh,")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{KindAnchor, KindImage, KindRefresh}, kinds)
+
+	kinds, err = ParseKinds("")
+	assert.Nil(t, err)
+	assert.Empty(t, kinds)
+
+	_, err = ParseKinds("a,video")
+	assert.EqualError(t, err, "unknown link kind video")
+}
+
+func TestRefreshURL(t *testing.T) {
+	testCases := map[string]string{
+		"5; url=/next":       "/next",
+		"0;URL='/next'":      "/next",
+		`3, url = "/next"`:   "/next",
+		"5;/next":            "/next",
+		"5":                  "",
+		"5; url=":            "",
+		"5; urlfoo=/next":    "",
+		"0; https://a.com/b": "https://a.com/b",
+	}
+	for content, expected := range testCases {
+		assert.Equal(t, expected, refreshURL(content), content)
+	}
+}
+
 func TestCrawl(t *testing.T) {
 	cfg := Config{
-		FollowExternalLinks: true,
+		Scope: ScopeAll,
 	}
 
 	c := NewCrawler(&testFetcher{}, new(logr.Logger), cfg)
-	found, err := c.Crawl("https://wanna-crawl.com/")
+	result, err := c.Crawl("https://wanna-crawl.com/")
 
 	assert.Nil(t, err)
+	assert.Equal(t, 200, result.StatusCode)
 	assert.Equal(t,
 		[]string{
 			"https://wanna-crawl.com/login",
 			"https://wanna-crawl.com/about-us",
 			"https://wanna-crawl.com/index.html",
 			"https://external.com/example",
-		}, found)
+		}, result.URLs())
+}
+
+func TestCrawlNonSuccessStatus(t *testing.T) {
+	c := NewCrawler(&testFetcher{}, new(logr.Logger), Config{Scope: ScopeAll})
+	result, err := c.Crawl("https://wanna-crawl.com/missing")
+
+	assert.EqualError(t, err, "https://wanna-crawl.com/missing returned status code 404")
+	assert.Equal(t, 404, result.StatusCode)
+	assert.Empty(t, result.Links)
+}
+
+func TestCrawlUnparsedBodies(t *testing.T) {
+	c := NewCrawler(&testFetcher{}, new(logr.Logger), Config{Scope: ScopeAll})
+
+	// Skipped bodies were not downloaded
+	result, err := c.Crawl("https://wanna-crawl.com/big.iso")
+	assert.Nil(t, err)
+	assert.Equal(t, "content type application/octet-stream is not allowed", result.Skipped)
+	assert.Nil(t, result.Links)
+
+	// Only HTML is parsed
+	result, err = c.Crawl("https://wanna-crawl.com/doc.pdf")
+	assert.Nil(t, err)
+	assert.Empty(t, result.Skipped)
+	assert.Equal(t, []Link{}, result.Links)
+
+	assert.True(t, IsHTML(""))
+	assert.True(t, IsHTML("text/html; charset=utf-8"))
+	assert.True(t, IsHTML("application/xhtml+xml"))
+	assert.False(t, IsHTML("text/plain"))
+	assert.False(t, IsHTML("image/svg+xml"))
+}
+
+func TestCheck(t *testing.T) {
+	c := NewCrawler(&testFetcher{}, new(logr.Logger), Config{})
+
+	result, err := c.Check("https://wanna-crawl.com/")
+	assert.Nil(t, err)
+	assert.Equal(t, 200, result.StatusCode)
+	assert.Empty(t, result.Body)
+	assert.Empty(t, result.Links)
+
+	// Falls back to GET, links are not extracted anyway
+	result, err = c.Check("https://wanna-crawl.com/no-head")
+	assert.Nil(t, err)
+	assert.Equal(t, 200, result.StatusCode)
+	assert.Empty(t, result.Links)
+
+	result, err = c.Check("https://wanna-crawl.com/missing")
+	assert.EqualError(t, err, "https://wanna-crawl.com/missing returned status code 404")
+	assert.Equal(t, 404, result.StatusCode)
 }
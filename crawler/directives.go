@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// directives are the indexing rules a page sets for every crawler, see
+// https://developers.google.com/search/docs/crawling-indexing/robots-meta-tag
+type directives struct {
+	// The page must not be indexed
+	noindex bool
+	// The links of the page must not be followed
+	nofollow bool
+}
+
+// Directives that take a value, like `max-snippet: 20`, not to be mistaken for a user agent prefix
+var valuedDirectives = map[string]bool{
+	"unavailable_after": true,
+	"max-snippet":       true,
+	"max-image-preview": true,
+	"max-video-preview": true,
+}
+
+// parseDirectives parses a comma separated list of directives, like `noindex, nofollow`
+func parseDirectives(content string) directives {
+	d := directives{}
+	for _, token := range strings.Split(content, ",") {
+		switch strings.ToLower(strings.TrimSpace(token)) {
+		case "noindex":
+			d.noindex = true
+		case "nofollow":
+			d.nofollow = true
+		case "none":
+			d.noindex, d.nofollow = true, true
+		}
+	}
+	return d
+}
+
+// headerDirectives returns the directives in the `X-Robots-Tag` headers. Values meant for a specific
+// crawler, like `googlebot: noindex`, are ignored.
+func headerDirectives(h http.Header) directives {
+	d := directives{}
+	for _, v := range h[http.CanonicalHeaderKey("X-Robots-Tag")] {
+		if i := strings.Index(v, ":"); i >= 0 {
+			agent := strings.ToLower(strings.TrimSpace(v[:i]))
+			if !strings.Contains(agent, ",") && !valuedDirectives[agent] {
+				continue
+			}
+		}
+		d = d.merge(parseDirectives(v))
+	}
+	return d
+}
+
+func (d directives) merge(other directives) directives {
+	return directives{
+		noindex:  d.noindex || other.noindex,
+		nofollow: d.nofollow || other.nofollow,
+	}
+}
+
+// relNofollow returns `true` if a `rel` attribute value, like `external nofollow`, has the nofollow keyword
+func relNofollow(rel string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, "nofollow") {
+			return true
+		}
+	}
+	return false
+}
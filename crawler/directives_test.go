@@ -0,0 +1,117 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/fcgravalos/wanna-crawl/fetcher"
+	logr "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDirectives(t *testing.T) {
+	testCases := []struct {
+		content  string
+		expected directives
+	}{
+		{"", directives{}},
+		{"all", directives{}},
+		{"index, follow", directives{}},
+		{"noindex", directives{noindex: true}},
+		{"NoFollow", directives{nofollow: true}},
+		{"noindex,nofollow", directives{noindex: true, nofollow: true}},
+		{" none ", directives{noindex: true, nofollow: true}},
+		{"max-snippet: 20, noindex", directives{noindex: true}},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, parseDirectives(tc.content), tc.content)
+	}
+}
+
+func TestHeaderDirectives(t *testing.T) {
+	testCases := []struct {
+		values   []string
+		expected directives
+	}{
+		{nil, directives{}},
+		{[]string{"noindex"}, directives{noindex: true}},
+		{[]string{"noindex", "nofollow"}, directives{noindex: true, nofollow: true}},
+		{[]string{"unavailable_after: 25 Jun 2010 15:00:00 PST"}, directives{}},
+		{[]string{"nofollow, unavailable_after: 25 Jun 2010 15:00:00 PST"}, directives{nofollow: true}},
+		// Directives meant for a specific crawler are ignored
+		{[]string{"googlebot: noindex"}, directives{}},
+		{[]string{"googlebot: noindex", "none"}, directives{noindex: true, nofollow: true}},
+	}
+
+	for _, tc := range testCases {
+		h := http.Header{}
+		for _, v := range tc.values {
+			h.Add("x-robots-tag", v)
+		}
+		assert.Equal(t, tc.expected, headerDirectives(h), tc.values)
+	}
+}
+
+func TestRelNofollow(t *testing.T) {
+	assert.True(t, relNofollow("nofollow"))
+	assert.True(t, relNofollow("external NOFOLLOW noopener"))
+	assert.False(t, relNofollow(""))
+	assert.False(t, relNofollow("nofollowing"))
+}
+
+const directivesPage = `<html><head><meta name="robots" content="%s"></head>
+<body><a href="/a">A</a><a href="/b" rel="external nofollow">B</a><map><area href="/c" rel="nofollow" alt="C"></map></body></html>`
+
+type directivesFetcher struct {
+	meta   string
+	header string
+}
+
+func (d *directivesFetcher) Fetch(url string) (*fetcher.Response, error) {
+	h := http.Header{}
+	if d.header != "" {
+		h.Set("X-Robots-Tag", d.header)
+	}
+	body := []byte(fmt.Sprintf(directivesPage, d.meta))
+	return &fetcher.Response{URL: url, FinalURL: url, StatusCode: 200, Header: h, Body: body}, nil
+}
+
+func (d *directivesFetcher) Head(url string) (*fetcher.Response, error) {
+	return d.Fetch(url)
+}
+
+func TestCrawlDirectives(t *testing.T) {
+	respectAll := Config{Extract: Kinds, RespectRelNofollow: true, RespectNofollow: true, RespectNoindex: true}
+	testCases := []struct {
+		name     string
+		cfg      Config
+		fetcher  *directivesFetcher
+		noindex  bool
+		nofollow []bool
+	}{
+		{"rel nofollow", respectAll, &directivesFetcher{meta: "all"}, false, []bool{false, true, true}},
+		{"meta nofollow", respectAll, &directivesFetcher{meta: "nofollow"}, false, []bool{true, true, true}},
+		{"meta noindex", respectAll, &directivesFetcher{meta: "noindex"}, true, []bool{false, true, true}},
+		{"meta none", respectAll, &directivesFetcher{meta: "none"}, true, []bool{true, true, true}},
+		{"header", respectAll, &directivesFetcher{meta: "all", header: "noindex, nofollow"}, true, []bool{true, true, true}},
+		{"header for another crawler", respectAll, &directivesFetcher{meta: "all", header: "googlebot: none"}, false, []bool{false, true, true}},
+		// Audit crawls can see everything
+		{"nothing respected", Config{Extract: Kinds}, &directivesFetcher{meta: "none", header: "none"}, false, []bool{false, false, false}},
+		{"rel nofollow only", Config{Extract: Kinds, RespectRelNofollow: true}, &directivesFetcher{meta: "none"}, false, []bool{false, true, true}},
+		{"noindex only", Config{Extract: Kinds, RespectNoindex: true}, &directivesFetcher{meta: "none"}, true, []bool{false, false, false}},
+	}
+
+	for _, tc := range testCases {
+		c := NewCrawler(tc.fetcher, new(logr.Logger), tc.cfg)
+		result, err := c.Crawl("https://wanna-crawl.com/")
+		assert.Nil(t, err, tc.name)
+		assert.Equal(t, tc.noindex, result.Noindex, tc.name)
+		nofollow := []bool{}
+		for _, l := range result.Links {
+			nofollow = append(nofollow, l.Nofollow)
+		}
+		assert.Equal(t, tc.nofollow, nofollow, tc.name)
+	}
+}
@@ -0,0 +1,155 @@
+package crawler
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"regexp"
+	"strings"
+)
+
+// Parts of a url a rule can match
+const (
+	TargetHost  = "host"
+	TargetPath  = "path"
+	TargetQuery = "query"
+	TargetURL   = "url"
+)
+
+// Rule includes or excludes the urls whose `Target` matches its pattern
+type Rule struct {
+	// Whether matching urls are included or excluded
+	Include bool
+	// What the pattern is matched against: the host, the path, every `name=value` query param or the whole url
+	Target string
+	// The pattern as written, a glob or a regexp if prefixed with `re:`
+	Pattern string
+
+	re *regexp.Regexp
+}
+
+// globToRegexp translates a glob, where `**` matches anything, `*` anything but a `/` and `?` a single character
+// other than a `/`, into an anchored regexp
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// ParseRule parses a rule written as `<include|exclude> <host|path|query|url> <pattern>`, like
+// `exclude path /docs/archive/**` or `include host re:^(www\.)?example\.com$`
+func ParseRule(s string) (*Rule, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("malformed rule %q, expected <include|exclude> <host|path|query|url> <pattern>", s)
+	}
+
+	r := &Rule{Target: fields[1], Pattern: fields[2]}
+	switch fields[0] {
+	case "include":
+		r.Include = true
+	case "exclude":
+	default:
+		return nil, fmt.Errorf("malformed rule %q, unknown action %s", s, fields[0])
+	}
+	switch r.Target {
+	case TargetHost, TargetPath, TargetQuery, TargetURL:
+	default:
+		return nil, fmt.Errorf("malformed rule %q, unknown target %s", s, r.Target)
+	}
+
+	expr := globToRegexp(r.Pattern)
+	if strings.HasPrefix(r.Pattern, "re:") {
+		expr = strings.TrimPrefix(r.Pattern, "re:")
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("malformed rule %q: %v", s, err)
+	}
+	r.re = re
+	return r, nil
+}
+
+// Matches returns `true` if the rule pattern matches the target of `u`
+func (r *Rule) Matches(u *neturl.URL) bool {
+	switch r.Target {
+	case TargetHost:
+		return r.re.MatchString(u.Hostname())
+	case TargetPath:
+		path := u.EscapedPath()
+		if path == "" {
+			path = "/"
+		}
+		return r.re.MatchString(path)
+	case TargetQuery:
+		for _, param := range strings.Split(u.RawQuery, "&") {
+			if param != "" && r.re.MatchString(param) {
+				return true
+			}
+		}
+		return false
+	default:
+		return r.re.MatchString(u.String())
+	}
+}
+
+func (r *Rule) String() string {
+	action := "exclude"
+	if r.Include {
+		action = "include"
+	}
+	return fmt.Sprintf("%s %s %s", action, r.Target, r.Pattern)
+}
+
+// Rules is an ordered list of rules, the first one matching a url decides whether it is crawled
+type Rules []*Rule
+
+// ParseRules reads one rule per line from `r`, skipping blank lines and `#` comments
+func ParseRules(r io.Reader) (Rules, error) {
+	rules := Rules{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := ParseRule(line)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// Allowed returns whether `u` must be crawled according to the first matching rule.
+// Urls matching no rule are allowed, unless there are include rules.
+func (rs Rules) Allowed(u string) bool {
+	parsed, err := neturl.Parse(u)
+	if err != nil {
+		return false
+	}
+	includes := false
+	for _, r := range rs {
+		if r.Matches(parsed) {
+			return r.Include
+		}
+		includes = includes || r.Include
+	}
+	return !includes
+}
@@ -0,0 +1,124 @@
+package crawler
+
+import (
+	neturl "net/url"
+	"strings"
+	"testing"
+
+	logr "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func rules(t *testing.T, lines ...string) Rules {
+	rs, err := ParseRules(strings.NewReader(strings.Join(lines, "\n")))
+	assert.Nil(t, err)
+	return rs
+}
+
+func TestParseRule(t *testing.T) {
+	r, err := ParseRule("exclude path /docs/archive/**")
+	assert.Nil(t, err)
+	assert.False(t, r.Include)
+	assert.Equal(t, TargetPath, r.Target)
+	assert.Equal(t, "/docs/archive/**", r.Pattern)
+	assert.Equal(t, "exclude path /docs/archive/**", r.String())
+
+	r, err = ParseRule("  include   host   re:^(www\\.)?example\\.com$ ")
+	assert.Nil(t, err)
+	assert.True(t, r.Include)
+	assert.Equal(t, TargetHost, r.Target)
+
+	_, err = ParseRule("exclude path")
+	assert.EqualError(t, err, `malformed rule "exclude path", expected <include|exclude> <host|path|query|url> <pattern>`)
+	_, err = ParseRule("skip path /a")
+	assert.EqualError(t, err, `malformed rule "skip path /a", unknown action skip`)
+	_, err = ParseRule("exclude fragment top")
+	assert.EqualError(t, err, `malformed rule "exclude fragment top", unknown target fragment`)
+	_, err = ParseRule("exclude path re:(")
+	assert.Error(t, err)
+}
+
+func TestParseRules(t *testing.T) {
+	rs, err := ParseRules(strings.NewReader("# docs only\n\nexclude path /docs/archive/**\n  include path /docs/**\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rs))
+	assert.Equal(t, "include path /docs/**", rs[1].String())
+
+	_, err = ParseRules(strings.NewReader("include path /docs/**\nexclude /docs/archive/**"))
+	assert.Error(t, err)
+}
+
+func TestRuleMatches(t *testing.T) {
+	testCases := []struct {
+		rule     string
+		url      string
+		expected bool
+	}{
+		{"include path /docs/**", "https://example.com/docs/", true},
+		{"include path /docs/**", "https://example.com/docs/a/b.html", true},
+		{"include path /docs/**", "https://example.com/docs", false},
+		{"include path /docs/*", "https://example.com/docs/a.html", true},
+		{"include path /docs/*", "https://example.com/docs/a/b.html", false},
+		{"include path /page-?", "https://example.com/page-1", true},
+		{"include path /page-?", "https://example.com/page-10", false},
+		{"include path /", "https://example.com", true},
+		{"include path *.pdf", "https://example.com/report.pdf", false},
+		{"include path **.pdf", "https://example.com/files/report.pdf", true},
+		// Escaped paths are matched as they are written
+		{"include path /a%20b", "https://example.com/a%20b", true},
+		{"include host *.example.com", "https://blog.example.com:8080/", true},
+		{"include host *.example.com", "https://example.com/", false},
+		{"include query print=1", "https://example.com/page?id=2&print=1", true},
+		{"include query print=1", "https://example.com/page?print=10", false},
+		{"include query print=*", "https://example.com/page?print=", true},
+		{"include query print=*", "https://example.com/page", false},
+		{"include url https://example.com/**", "https://example.com/a?b=c", true},
+		{"include url https://example.com/**", "http://example.com/a", false},
+		// Regular expressions match anywhere unless anchored
+		{`include path re:\.pdf$`, "https://example.com/files/report.pdf", true},
+		{`include path re:^/docs`, "https://example.com/en/docs", false},
+		{`include url re:[?&]sessionid=`, "https://example.com/?a=1&sessionid=2", true},
+	}
+
+	for _, tc := range testCases {
+		r, err := ParseRule(tc.rule)
+		assert.Nil(t, err)
+		u, _ := neturl.Parse(tc.url)
+		assert.Equal(t, tc.expected, r.Matches(u), tc.rule+" "+tc.url)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	docs := rules(t, "exclude path /docs/archive/**", "exclude query print=1", "include path /docs/**")
+	assert.True(t, docs.Allowed("https://example.com/docs/intro.html"))
+	assert.False(t, docs.Allowed("https://example.com/docs/archive/2019.html"))
+	assert.False(t, docs.Allowed("https://example.com/docs/intro.html?print=1"))
+	// Nothing matches and there are include rules
+	assert.False(t, docs.Allowed("https://example.com/blog/"))
+
+	// The first matching rule wins
+	first := rules(t, "include path /docs/**", "exclude path /docs/archive/**")
+	assert.True(t, first.Allowed("https://example.com/docs/archive/2019.html"))
+
+	// Nothing matches and there are only exclude rules
+	excludes := rules(t, "exclude host ads.example.com")
+	assert.True(t, excludes.Allowed("https://example.com/"))
+	assert.False(t, excludes.Allowed("https://ads.example.com/banner"))
+
+	assert.True(t, Rules(nil).Allowed("https://example.com/"))
+}
+
+func TestExtractLinksWithRules(t *testing.T) {
+	c := &Crawler{nil, new(logr.Logger), Config{
+		Scope: ScopeAll,
+		Rules: rules(t, "exclude path /docs/archive/**", "exclude query print=1", "include path /docs/**"),
+	}}
+	page := []byte(`<a href="/docs/intro.html">Intro</a><a href="/docs/archive/old.html">Old</a>
+<a href="/docs/intro.html?print=1">Print</a><a href="/blog/">Blog</a><a href="https://other.com/docs/x">Other</a>`)
+
+	links, _ := c.extractLinksFromPage("https://wanna-crawl.com/", "https://wanna-crawl.com/", page)
+	assert.Equal(t, []Link{
+		{URL: "https://wanna-crawl.com/docs/intro.html", Text: "Intro", Kind: KindAnchor},
+		{URL: "https://other.com/docs/x", Text: "Other", Kind: KindAnchor},
+	}, links)
+}
@@ -0,0 +1,88 @@
+package crawler
+
+import (
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Scope modes, deciding which links are extracted from a page
+const (
+	// Links to the host of the page only
+	ScopeHost = "host"
+	// Links to any host under the registrable domain of the page, like `blog.example.com` from `www.example.com`
+	ScopeDomain = "domain"
+	// Links to the hosts in `Config.AllowedHosts` only
+	ScopeAllowlist = "allowlist"
+	// Links to any host
+	ScopeAll = "all"
+)
+
+// Scopes are all the scope modes
+var Scopes = []string{ScopeHost, ScopeDomain, ScopeAllowlist, ScopeAll}
+
+// ValidScope returns an error if `scope` is not one of `Scopes`
+func ValidScope(scope string) error {
+	for _, s := range Scopes {
+		if s == scope {
+			return nil
+		}
+	}
+	return fmt.Errorf("scope %s not supported", scope)
+}
+
+// registrableDomain returns the eTLD+1 of `host`, according to the public suffix list embedded in the binary.
+// IP addresses, and hosts that are public suffixes themselves, are their own domain.
+func registrableDomain(host string) string {
+	host = strings.ToLower(host)
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// allowed returns `true` if `host` is in `Config.AllowedHosts`, where `*.example.com` allows any subdomain of `example.com`
+func (c *Crawler) allowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range c.AllowedHosts {
+		h = strings.ToLower(h)
+		if strings.HasPrefix(h, "*.") {
+			if strings.HasSuffix(host, h[1:]) {
+				return true
+			}
+		} else if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// InScope returns `true` if links from the `from` url to the `to` url must be extracted according to `Config.Scope`
+func (c *Crawler) InScope(from string, to string) bool {
+	a, err := neturl.Parse(from)
+	if err != nil {
+		return false
+	}
+	b, err := neturl.Parse(to)
+	if err != nil {
+		return false
+	}
+
+	switch c.Scope {
+	case ScopeAll:
+		return true
+	case ScopeDomain:
+		return registrableDomain(a.Hostname()) == registrableDomain(b.Hostname())
+	case ScopeAllowlist:
+		return c.allowed(b.Hostname())
+	default:
+		return strings.EqualFold(a.Hostname(), b.Hostname())
+	}
+}
@@ -0,0 +1,87 @@
+package crawler
+
+import (
+	"testing"
+
+	logr "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidScope(t *testing.T) {
+	for _, s := range Scopes {
+		assert.Nil(t, ValidScope(s))
+	}
+	assert.EqualError(t, ValidScope("subdomain"), "scope subdomain not supported")
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	testCases := []struct {
+		host     string
+		expected string
+	}{
+		{"example.com", "example.com"},
+		{"www.example.com", "example.com"},
+		{"a.b.Example.COM", "example.com"},
+		{"www.example.co.uk", "example.co.uk"},
+		{"shop.example.com.au", "example.com.au"},
+		// Private suffixes are registrable domains of their own
+		{"alice.github.io", "alice.github.io"},
+		// Public suffixes, IPs and single labels are their own domain
+		{"co.uk", "co.uk"},
+		{"127.0.0.1", "127.0.0.1"},
+		{"::1", "::1"},
+		{"localhost", "localhost"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, registrableDomain(tc.host), tc.host)
+	}
+}
+
+func TestInScope(t *testing.T) {
+	testCases := []struct {
+		cfg      Config
+		from     string
+		to       string
+		expected bool
+	}{
+		// Only the page host if no scope is set
+		{Config{}, "https://wanna-crawl.com/", "https://wanna-crawl.com/login", true},
+		{Config{}, "https://wanna-crawl.com/", "https://community.wanna-crawl.com/awesome", false},
+		{Config{Scope: ScopeHost}, "https://wanna-crawl.com/", "https://WANNA-CRAWL.com:8080/login", true},
+		{Config{Scope: ScopeHost}, "https://www.wanna-crawl.com/", "https://wanna-crawl.com/", false},
+		{Config{Scope: ScopeDomain}, "https://www.wanna-crawl.com/", "https://wanna-crawl.com/", true},
+		{Config{Scope: ScopeDomain}, "https://www.wanna-crawl.com/", "https://blog.wanna-crawl.com/", true},
+		{Config{Scope: ScopeDomain}, "https://www.wanna-crawl.com/", "https://wanna-crawl.co.uk/", false},
+		{Config{Scope: ScopeDomain}, "https://www.example.co.uk/", "https://shop.example.co.uk/", true},
+		{Config{Scope: ScopeDomain}, "https://www.example.co.uk/", "https://other.co.uk/", false},
+		{Config{Scope: ScopeDomain}, "https://alice.github.io/", "https://bob.github.io/", false},
+		{Config{Scope: ScopeDomain}, "http://127.0.0.1:8080/", "http://127.0.0.2:8080/", false},
+		{Config{Scope: ScopeAllowlist, AllowedHosts: []string{"wanna-crawl.com", "*.docs.wanna-crawl.com"}}, "https://www.wanna-crawl.com/", "https://wanna-crawl.com/", true},
+		{Config{Scope: ScopeAllowlist, AllowedHosts: []string{"wanna-crawl.com", "*.docs.wanna-crawl.com"}}, "https://wanna-crawl.com/", "https://www.wanna-crawl.com/", false},
+		{Config{Scope: ScopeAllowlist, AllowedHosts: []string{"wanna-crawl.com", "*.docs.wanna-crawl.com"}}, "https://wanna-crawl.com/", "https://en.docs.wanna-crawl.com/", true},
+		{Config{Scope: ScopeAllowlist, AllowedHosts: []string{"wanna-crawl.com", "*.docs.wanna-crawl.com"}}, "https://wanna-crawl.com/", "https://docs.wanna-crawl.com/", false},
+		{Config{Scope: ScopeAll}, "https://wanna-crawl.com/", "https://external.com/", true},
+	}
+
+	for _, tc := range testCases {
+		c := &Crawler{nil, new(logr.Logger), tc.cfg}
+		assert.Equal(t, tc.expected, c.InScope(tc.from, tc.to), tc.cfg.Scope+" "+tc.from+" "+tc.to)
+	}
+}
+
+func TestExtractOutOfScope(t *testing.T) {
+	page := []byte(`<a href="/a">A</a><a href="https://blog.wanna-crawl.com/">Blog</a><a href="https://external.com/">External</a>`)
+
+	c := &Crawler{nil, new(logr.Logger), Config{Scope: ScopeDomain}}
+	links, _ := c.extractLinksFromPage("https://www.wanna-crawl.com/", "https://www.wanna-crawl.com/", page)
+	assert.Equal(t, []Link{
+		{URL: "https://www.wanna-crawl.com/a", Text: "A", Kind: KindAnchor},
+		{URL: "https://blog.wanna-crawl.com/", Text: "Blog", Kind: KindAnchor},
+	}, links)
+
+	c = &Crawler{nil, new(logr.Logger), Config{Scope: ScopeDomain, ExtractOutOfScope: true}}
+	links, _ = c.extractLinksFromPage("https://www.wanna-crawl.com/", "https://www.wanna-crawl.com/", page)
+	assert.Equal(t, 3, len(links))
+	assert.False(t, c.InScope("https://www.wanna-crawl.com/", "https://external.com/"))
+}
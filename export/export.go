@@ -0,0 +1,65 @@
+package export
+
+import (
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"strings"
+
+	"github.com/fcgravalos/wanna-crawl/storage"
+)
+
+// readPages returns every page in `db`, sorted by url
+func readPages(db storage.Storage) ([]*storage.Page, error) {
+	w, ok := db.(storage.Walker)
+	if !ok {
+		return nil, fmt.Errorf("storage engine doesn't support reading pages back")
+	}
+	pages := []*storage.Page{}
+	err := w.Walk(func(p *storage.Page) error {
+		pages = append(pages, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].URL < pages[j].URL })
+	return pages, nil
+}
+
+// hostname returns the lower cased host of `u`, or an empty string if it is not a valid url
+func hostname(u string) string {
+	parsed, err := neturl.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// seeds returns the url of the `pages` at depth 0
+func seeds(pages []*storage.Page) []string {
+	urls := []string{}
+	for _, p := range pages {
+		if p.Depth == 0 {
+			urls = append(urls, p.URL)
+		}
+	}
+	return urls
+}
+
+// internalHosts returns the set of `hosts`, or the hosts of the seeds in `pages` if there are none
+func internalHosts(pages []*storage.Page, hosts []string) map[string]bool {
+	if len(hosts) == 0 {
+		hosts = []string{}
+		for _, s := range seeds(pages) {
+			hosts = append(hosts, hostname(s))
+		}
+	}
+	internal := map[string]bool{}
+	for _, h := range hosts {
+		if h != "" {
+			internal[strings.ToLower(h)] = true
+		}
+	}
+	return internal
+}
@@ -0,0 +1,219 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fcgravalos/wanna-crawl/storage"
+)
+
+// GraphConfig represents the link graph exporters configuration
+type GraphConfig struct {
+	// Hosts considered internal, defaults to the hosts of the seeds
+	Hosts []string
+	// Whether to replace every external url by a single node per host
+	CollapseExternal bool
+}
+
+// node is a url, or an external host when collapsed, in the link graph
+type node struct {
+	id       string
+	internal bool
+	// Whether the url was crawled, `depth` and `status` are only meaningful if it was
+	crawled bool
+	depth   int
+	status  int
+	failed  bool
+}
+
+type edge struct {
+	from string
+	to   string
+	text string
+}
+
+type graph struct {
+	nodes []*node
+	edges []*edge
+}
+
+// buildGraph returns the link graph of the pages in `db`, nodes and edges sorted
+func buildGraph(db storage.Storage, cfg GraphConfig) (*graph, error) {
+	pages, err := readPages(db)
+	if err != nil {
+		return nil, err
+	}
+	internal := internalHosts(pages, cfg.Hosts)
+
+	nodes := map[string]*node{}
+	// add returns the node of url `u`, creating it if needed
+	add := func(u string) *node {
+		host := hostname(u)
+		id := u
+		if cfg.CollapseExternal && !internal[host] {
+			id = host
+		}
+		n, ok := nodes[id]
+		if !ok {
+			n = &node{id: id, internal: internal[host]}
+			nodes[id] = n
+		}
+		return n
+	}
+
+	edges := map[[2]string]*edge{}
+	for _, p := range pages {
+		n := add(p.URL)
+		if n.id == p.URL {
+			n.crawled, n.depth, n.status, n.failed = true, p.Depth, p.StatusCode, p.Error != ""
+		}
+		for _, l := range p.Links {
+			to := add(l.URL)
+			key := [2]string{n.id, to.id}
+			if _, ok := edges[key]; ok || n.id == to.id {
+				continue
+			}
+			edges[key] = &edge{from: n.id, to: to.id, text: l.Text}
+		}
+	}
+
+	g := &graph{}
+	for _, n := range nodes {
+		g.nodes = append(g.nodes, n)
+	}
+	sort.Slice(g.nodes, func(i, j int) bool { return g.nodes[i].id < g.nodes[j].id })
+	for _, e := range edges {
+		g.edges = append(g.edges, e)
+	}
+	sort.Slice(g.edges, func(i, j int) bool {
+		if g.edges[i].from != g.edges[j].from {
+			return g.edges[i].from < g.edges[j].from
+		}
+		return g.edges[i].to < g.edges[j].to
+	})
+	return g, nil
+}
+
+// quote returns `s` as a DOT quoted string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// DOT writes the link graph of the pages in `db` to `w` in Graphviz DOT format.
+// Nodes carry the `depth`, `status` and `internal` attributes. External nodes are dashed and failed ones red.
+func DOT(db storage.Storage, w io.Writer, cfg GraphConfig) error {
+	g, err := buildGraph(db, cfg)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph \"wanna-crawl\" {\n")
+	for _, n := range g.nodes {
+		attrs := []string{"internal=" + strconv.FormatBool(n.internal)}
+		if n.crawled {
+			attrs = append(attrs, "depth="+strconv.Itoa(n.depth), "status="+strconv.Itoa(n.status))
+		}
+		if !n.internal {
+			attrs = append(attrs, "style=dashed")
+		}
+		if n.failed {
+			attrs = append(attrs, "color=red")
+		}
+		b.WriteString(fmt.Sprintf("\t%s [%s];\n", quote(n.id), strings.Join(attrs, ", ")))
+	}
+	for _, e := range g.edges {
+		b.WriteString(fmt.Sprintf("\t%s -> %s;\n", quote(e.from), quote(e.to)))
+	}
+	b.WriteString("}\n")
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+type graphmlKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphmlNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+type graphmlGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphmlNode `xml:"node"`
+	Edges       []graphmlEdge `xml:"edge"`
+}
+
+type graphml struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphmlKey `xml:"key"`
+	Graph   graphmlGraph `xml:"graph"`
+}
+
+// GraphML writes the link graph of the pages in `db` to `w` in GraphML format.
+// Nodes carry the `depth`, `status` and `internal` attributes and edges the anchor `text`.
+func GraphML(db storage.Storage, w io.Writer, cfg GraphConfig) error {
+	g, err := buildGraph(db, cfg)
+	if err != nil {
+		return err
+	}
+
+	doc := graphml{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphmlKey{
+			{ID: "depth", For: "node", Name: "depth", Type: "int"},
+			{ID: "status", For: "node", Name: "status", Type: "int"},
+			{ID: "internal", For: "node", Name: "internal", Type: "boolean"},
+			{ID: "text", For: "edge", Name: "text", Type: "string"},
+		},
+		Graph: graphmlGraph{ID: "wanna-crawl", EdgeDefault: "directed"},
+	}
+	for _, n := range g.nodes {
+		gn := graphmlNode{ID: n.id}
+		if n.crawled {
+			gn.Data = append(gn.Data, graphmlData{"depth", strconv.Itoa(n.depth)}, graphmlData{"status", strconv.Itoa(n.status)})
+		}
+		gn.Data = append(gn.Data, graphmlData{"internal", strconv.FormatBool(n.internal)})
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gn)
+	}
+	for _, e := range g.edges {
+		ge := graphmlEdge{Source: e.from, Target: e.to}
+		if e.text != "" {
+			ge.Data = append(ge.Data, graphmlData{"text", e.text})
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, ge)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
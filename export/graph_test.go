@@ -0,0 +1,109 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fcgravalos/wanna-crawl/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func linkedStorage() storage.Storage {
+	db, _ := storage.NewStorage("in-memory", storage.Config{})
+	pages := []*storage.Page{
+		{URL: "https://example.com/", StatusCode: 200, Links: []storage.Link{
+			{URL: "https://example.com/a", Text: "Say \"A\""},
+			{URL: "https://example.com/missing"},
+			{URL: "https://external.com/x"},
+			{URL: "https://external.com/y"},
+		}},
+		{URL: "https://example.com/a", Depth: 1, StatusCode: 200, Links: []storage.Link{
+			{URL: "https://example.com/", Text: "Home"},
+			{URL: "https://example.com/deep"},
+		}},
+		{URL: "https://example.com/missing", Depth: 1, StatusCode: 404, Error: "https://example.com/missing returned status code 404"},
+		{URL: "https://external.com/x", Depth: 1, StatusCode: 200, Links: []storage.Link{}},
+	}
+	for _, p := range pages {
+		db.Store(p)
+	}
+	return db
+}
+
+func TestDOT(t *testing.T) {
+	var out bytes.Buffer
+	assert.Nil(t, DOT(linkedStorage(), &out, GraphConfig{}))
+
+	expected := `digraph "wanna-crawl" {
+	"https://example.com/" [internal=true, depth=0, status=200];
+	"https://example.com/a" [internal=true, depth=1, status=200];
+	"https://example.com/deep" [internal=true];
+	"https://example.com/missing" [internal=true, depth=1, status=404, color=red];
+	"https://external.com/x" [internal=false, depth=1, status=200, style=dashed];
+	"https://external.com/y" [internal=false, style=dashed];
+	"https://example.com/" -> "https://example.com/a";
+	"https://example.com/" -> "https://example.com/missing";
+	"https://example.com/" -> "https://external.com/x";
+	"https://example.com/" -> "https://external.com/y";
+	"https://example.com/a" -> "https://example.com/";
+	"https://example.com/a" -> "https://example.com/deep";
+}
+`
+	assert.Equal(t, expected, out.String())
+}
+
+func TestDOTCollapseExternal(t *testing.T) {
+	var out bytes.Buffer
+	assert.Nil(t, DOT(linkedStorage(), &out, GraphConfig{CollapseExternal: true}))
+
+	assert.Contains(t, out.String(), "\t\"external.com\" [internal=false, style=dashed];\n")
+	assert.Contains(t, out.String(), "\t\"https://example.com/\" -> \"external.com\";\n")
+	assert.NotContains(t, out.String(), "https://external.com/")
+}
+
+func TestGraphML(t *testing.T) {
+	var out bytes.Buffer
+	assert.Nil(t, GraphML(linkedStorage(), &out, GraphConfig{CollapseExternal: true}))
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<graphml xmlns="http://graphml.graphdrawing.org/xmlns">
+  <key id="depth" for="node" attr.name="depth" attr.type="int"></key>
+  <key id="status" for="node" attr.name="status" attr.type="int"></key>
+  <key id="internal" for="node" attr.name="internal" attr.type="boolean"></key>
+  <key id="text" for="edge" attr.name="text" attr.type="string"></key>
+  <graph id="wanna-crawl" edgedefault="directed">
+    <node id="external.com">
+      <data key="internal">false</data>
+    </node>
+    <node id="https://example.com/">
+      <data key="depth">0</data>
+      <data key="status">200</data>
+      <data key="internal">true</data>
+    </node>
+    <node id="https://example.com/a">
+      <data key="depth">1</data>
+      <data key="status">200</data>
+      <data key="internal">true</data>
+    </node>
+    <node id="https://example.com/deep">
+      <data key="internal">true</data>
+    </node>
+    <node id="https://example.com/missing">
+      <data key="depth">1</data>
+      <data key="status">404</data>
+      <data key="internal">true</data>
+    </node>
+    <edge source="https://example.com/" target="external.com"></edge>
+    <edge source="https://example.com/" target="https://example.com/a">
+      <data key="text">Say &#34;A&#34;</data>
+    </edge>
+    <edge source="https://example.com/" target="https://example.com/missing"></edge>
+    <edge source="https://example.com/a" target="https://example.com/">
+      <data key="text">Home</data>
+    </edge>
+    <edge source="https://example.com/a" target="https://example.com/deep"></edge>
+  </graph>
+</graphml>
+`
+	assert.Equal(t, expected, out.String())
+}
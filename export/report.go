@@ -0,0 +1,162 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/fcgravalos/wanna-crawl/storage"
+)
+
+// Supported reports
+const (
+	InboundReport     = "inbound"
+	OrphansReport     = "orphans"
+	BrokenLinksReport = "broken-links"
+	DepthReport       = "depth"
+)
+
+// ReportConfig represents the report to print
+type ReportConfig struct {
+	// One of the supported reports
+	Kind string
+	// Url whose inbound links are reported
+	URL string
+	// Depth whose pages are reported
+	Depth int
+}
+
+// ValidReport returns an error if `kind` is not a supported report
+func ValidReport(kind string) error {
+	switch kind {
+	case InboundReport, OrphansReport, BrokenLinksReport, DepthReport:
+		return nil
+	}
+	return fmt.Errorf("report %s not supported", kind)
+}
+
+// Report writes to `w` the answer of `db` to the `cfg` report, one tab separated line per result:
+//
+//   - inbound: the page linking to `cfg.URL` and the anchor text
+//   - orphans: the page no other page of its host links to, its depth and status
+//   - broken-links: the page, the url it links to, its status and why it could not be crawled
+//   - depth: the page found `cfg.Depth` links away from the seeds and its status
+func Report(db storage.Storage, w io.Writer, cfg ReportConfig) error {
+	if err := ValidReport(cfg.Kind); err != nil {
+		return err
+	}
+	q, ok := db.(storage.Querier)
+	if !ok {
+		return fmt.Errorf("storage engine doesn't support queries")
+	}
+
+	lines := [][]interface{}{}
+	switch cfg.Kind {
+	case InboundReport:
+		edges, err := q.Inbound(cfg.URL)
+		if err != nil {
+			return err
+		}
+		for _, e := range edges {
+			lines = append(lines, []interface{}{e.From, e.Text})
+		}
+	case OrphansReport:
+		pages, err := q.Orphans()
+		if err != nil {
+			return err
+		}
+		for _, p := range pages {
+			lines = append(lines, []interface{}{p.URL, p.Depth, p.StatusCode})
+		}
+	case BrokenLinksReport:
+		broken, err := q.BrokenLinks()
+		if err != nil {
+			return err
+		}
+		for _, b := range broken {
+			lines = append(lines, []interface{}{b.From, b.To, b.StatusCode, b.Error})
+		}
+	case DepthReport:
+		pages, err := q.AtDepth(cfg.Depth)
+		if err != nil {
+			return err
+		}
+		for _, p := range pages {
+			lines = append(lines, []interface{}{p.URL, p.StatusCode})
+		}
+	}
+
+	for _, line := range lines {
+		fields := make([]string, 0, len(line))
+		for _, f := range line {
+			fields = append(fields, fmt.Sprint(f))
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(fields, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BrokenLinks writes to `w` the links of `db` pointing to urls that could not be crawled, grouped by the page
+// they were found in, and returns how many there are. Every page is followed by one tab indented line per
+// broken link, with the status, or `failed` if there was no response, the url and why it could not be crawled.
+func BrokenLinks(db storage.Storage, w io.Writer) (int, error) {
+	q, ok := db.(storage.Querier)
+	if !ok {
+		return 0, fmt.Errorf("storage engine doesn't support queries")
+	}
+	broken, err := q.BrokenLinks()
+	if err != nil {
+		return 0, err
+	}
+
+	var b strings.Builder
+	for i, l := range broken {
+		if i == 0 || broken[i-1].From != l.From {
+			b.WriteString(l.From + "\n")
+		}
+		status := "failed"
+		if l.StatusCode != 0 {
+			status = fmt.Sprint(l.StatusCode)
+		}
+		b.WriteString(fmt.Sprintf("\t%s\t%s\t%s\n", status, l.To, l.Error))
+	}
+	_, err = io.WriteString(w, b.String())
+	return len(broken), err
+}
+
+// Unreached writes to `w` the `urls` no page in `db` links to, one per line and sorted, and returns how many
+// there are. Links from a page to itself don't count.
+func Unreached(db storage.Storage, w io.Writer, urls []string) (int, error) {
+	pages, err := readPages(db)
+	if err != nil {
+		return 0, err
+	}
+	linked := map[string]bool{}
+	for _, p := range pages {
+		for _, l := range p.Links {
+			if l.URL != p.URL {
+				linked[l.URL] = true
+			}
+		}
+	}
+
+	unreached := []string{}
+	for _, u := range urls {
+		if !linked[u] {
+			unreached = append(unreached, u)
+			// Listed twice, reported once
+			linked[u] = true
+		}
+	}
+	sort.Strings(unreached)
+
+	var b strings.Builder
+	for _, u := range unreached {
+		b.WriteString(u + "\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return len(unreached), err
+}
@@ -0,0 +1,106 @@
+package export
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/fcgravalos/wanna-crawl/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	testCases := []struct {
+		cfg      ReportConfig
+		expected string
+	}{
+		{
+			ReportConfig{Kind: InboundReport, URL: "https://example.com/"},
+			"https://example.com/a\tHome\n",
+		},
+		{
+			ReportConfig{Kind: OrphansReport},
+			"https://external.com/x\t1\t200\n",
+		},
+		{
+			ReportConfig{Kind: BrokenLinksReport},
+			"https://example.com/\thttps://example.com/missing\t404\thttps://example.com/missing returned status code 404\n",
+		},
+		{
+			ReportConfig{Kind: DepthReport, Depth: 1},
+			"https://example.com/a\t200\nhttps://example.com/missing\t404\nhttps://external.com/x\t200\n",
+		},
+		{
+			ReportConfig{Kind: DepthReport, Depth: 2},
+			"",
+		},
+	}
+
+	db := linkedStorage()
+	for _, tc := range testCases {
+		var out bytes.Buffer
+		assert.Nil(t, Report(db, &out, tc.cfg))
+		assert.Equal(t, tc.expected, out.String(), tc.cfg.Kind)
+	}
+}
+
+func TestReportErrors(t *testing.T) {
+	err := Report(linkedStorage(), new(bytes.Buffer), ReportConfig{Kind: "popular"})
+	assert.EqualError(t, err, "report popular not supported")
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	db, _ := storage.NewStorage("jsonl", storage.Config{Path: filepath.Join(dir, "crawl.jsonl")})
+	defer db.(io.Closer).Close()
+	err = Report(db, new(bytes.Buffer), ReportConfig{Kind: OrphansReport})
+	assert.EqualError(t, err, "storage engine doesn't support queries")
+}
+
+func TestBrokenLinks(t *testing.T) {
+	db := linkedStorage()
+	db.Store(&storage.Page{URL: "https://example.com/a", Depth: 1, StatusCode: 200, Links: []storage.Link{{URL: "https://example.com/missing"}, {URL: "https://example.com/down"}}})
+	db.Store(&storage.Page{URL: "https://example.com/down", Depth: 2, Error: "Get \"https://example.com/down\": context deadline exceeded"})
+
+	var out bytes.Buffer
+	n, err := BrokenLinks(db, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	expected := `https://example.com/
+	404	https://example.com/missing	https://example.com/missing returned status code 404
+https://example.com/a
+	failed	https://example.com/down	Get "https://example.com/down": context deadline exceeded
+	404	https://example.com/missing	https://example.com/missing returned status code 404
+`
+	assert.Equal(t, expected, out.String())
+
+	out.Reset()
+	empty, _ := storage.NewStorage("in-memory", storage.Config{})
+	n, err = BrokenLinks(empty, &out)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.Empty(t, out.String())
+}
+
+func TestUnreached(t *testing.T) {
+	var out bytes.Buffer
+	urls := []string{"https://example.com/lonely", "https://example.com/a", "https://example.com/deep", "https://example.com/", "https://example.com/lonely", "https://external.com/x"}
+	n, err := Unreached(linkedStorage(), &out, urls)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "https://example.com/lonely\n", out.String())
+
+	// Links from a page to itself don't count
+	db, _ := storage.NewStorage("in-memory", storage.Config{})
+	db.Store(&storage.Page{URL: "https://example.com/", Links: []storage.Link{{URL: "https://example.com/"}}})
+	out.Reset()
+	n, err = Unreached(db, &out, []string{"https://example.com/"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	jsonl, _ := storage.NewStorage("jsonl", storage.Config{Path: filepath.Join(dir, "crawl.jsonl")})
+	_, err = Unreached(jsonl, &out, urls)
+	assert.EqualError(t, err, "storage engine doesn't support reading pages back")
+}
@@ -0,0 +1,243 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fcgravalos/wanna-crawl/crawler"
+	"github.com/fcgravalos/wanna-crawl/storage"
+)
+
+// Limits of a single sitemap file, see https://www.sitemaps.org/protocol.html
+const (
+	MaxSitemapURLs  = 50000
+	MaxSitemapBytes = 50 * 1024 * 1024
+	maxLocLength    = 2048
+)
+
+const (
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	sitemapFile      = "sitemap"
+)
+
+// SitemapConfig represents the XML sitemap exporter configuration
+type SitemapConfig struct {
+	// Directory the sitemap files are written to
+	Dir string
+	// Where the sitemap files will be served from, used to reference them from the sitemap index.
+	// Defaults to the root of the first seed.
+	BaseURL string
+	// Hosts considered internal, defaults to the hosts of the seeds
+	Hosts []string
+	// Whether to gzip the sitemap files
+	Gzip bool
+	// Limits of a single sitemap file, the protocol ones by default
+	MaxURLs  int
+	MaxBytes int
+}
+
+type sitemapURL struct {
+	XMLName xml.Name `xml:"url"`
+	Loc     string   `xml:"loc"`
+	LastMod string   `xml:"lastmod,omitempty"`
+}
+
+type sitemapRef struct {
+	XMLName xml.Name `xml:"sitemap"`
+	Loc     string   `xml:"loc"`
+	LastMod string   `xml:"lastmod,omitempty"`
+}
+
+// entry is a url to be listed in the sitemap
+type entry struct {
+	loc     string
+	lastMod time.Time
+}
+
+// chunk is the content of a single sitemap file
+type chunk struct {
+	body    bytes.Buffer
+	urls    int
+	lastMod time.Time
+}
+
+func lastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// entries returns the internal, successfully fetched, indexable HTML pages in `db`, sorted by url.
+// It also returns the seeds, the pages at depth 0, also sorted.
+func entries(db storage.Storage, hosts []string) ([]entry, []string, error) {
+	pages, err := readPages(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	internal := internalHosts(pages, hosts)
+
+	byLoc := map[string]entry{}
+	for _, p := range pages {
+		if p.Error != "" || p.StatusCode < 200 || p.StatusCode > 299 || !crawler.IsHTML(p.ContentType) || p.Noindex {
+			continue
+		}
+		// Redirected urls are listed by where they landed
+		loc := p.URL
+		if p.FinalURL != "" {
+			loc = p.FinalURL
+		}
+		if len(loc) > maxLocLength || !internal[hostname(loc)] {
+			continue
+		}
+		if e, ok := byLoc[loc]; !ok || p.FetchedAt.After(e.lastMod) {
+			byLoc[loc] = entry{loc: loc, lastMod: p.FetchedAt}
+		}
+	}
+
+	list := []entry{}
+	for _, e := range byLoc {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].loc < list[j].loc })
+	return list, seeds(pages), nil
+}
+
+// split spreads `list` over as many sitemap files as needed to keep every one of them within the limits
+func split(list []entry, maxURLs int, maxBytes int) ([]*chunk, error) {
+	header := fmt.Sprintf("%s<urlset xmlns=\"%s\">\n", xml.Header, sitemapNamespace)
+	footer := "</urlset>\n"
+
+	chunks := []*chunk{}
+	var current *chunk
+	for _, e := range list {
+		el, err := xml.Marshal(sitemapURL{Loc: e.loc, LastMod: lastMod(e.lastMod)})
+		if err != nil {
+			return nil, err
+		}
+		el = append(el, '\n')
+		if len(header)+len(el)+len(footer) > maxBytes {
+			return nil, fmt.Errorf("%s does not fit in a sitemap of %d bytes", e.loc, maxBytes)
+		}
+		if current == nil || current.urls == maxURLs || current.body.Len()+len(el)+len(footer) > maxBytes {
+			if current != nil {
+				current.body.WriteString(footer)
+			}
+			current = &chunk{}
+			current.body.WriteString(header)
+			chunks = append(chunks, current)
+		}
+		current.body.Write(el)
+		current.urls++
+		if e.lastMod.After(current.lastMod) {
+			current.lastMod = e.lastMod
+		}
+	}
+	if current == nil {
+		// An empty sitemap is still a valid one
+		current = &chunk{}
+		current.body.WriteString(header)
+		chunks = append(chunks, current)
+	}
+	current.body.WriteString(footer)
+	return chunks, nil
+}
+
+func writeSitemapFile(path string, body []byte, compress bool) error {
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = fd
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(fd)
+		w = gz
+	}
+	if _, err := w.Write(body); err != nil {
+		fd.Close()
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			fd.Close()
+			return err
+		}
+	}
+	return fd.Close()
+}
+
+// Sitemap writes the internal, successfully fetched, indexable HTML pages in `db` as sitemaps.org XML files into `cfg.Dir`.
+// Every page is listed with its fetch time as last modification. Pages are split into as many sitemap files
+// as needed, and referenced from a sitemap index, when they don't fit into a single one.
+// It returns the path of the files written, the sitemap or the sitemap index first.
+func Sitemap(db storage.Storage, cfg SitemapConfig) ([]string, error) {
+	if cfg.MaxURLs <= 0 || cfg.MaxURLs > MaxSitemapURLs {
+		cfg.MaxURLs = MaxSitemapURLs
+	}
+	if cfg.MaxBytes <= 0 || cfg.MaxBytes > MaxSitemapBytes {
+		cfg.MaxBytes = MaxSitemapBytes
+	}
+	ext := ".xml"
+	if cfg.Gzip {
+		ext += ".gz"
+	}
+
+	list, seedURLs, err := entries(db, cfg.Hosts)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := split(list, cfg.MaxURLs, cfg.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	index := filepath.Join(cfg.Dir, sitemapFile+ext)
+	if len(chunks) == 1 {
+		return []string{index}, writeSitemapFile(index, chunks[0].body.Bytes(), cfg.Gzip)
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" && len(seedURLs) > 0 {
+		if u, err := neturl.Parse(seedURLs[0]); err == nil {
+			baseURL = u.Scheme + "://" + u.Host
+		}
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("a base url is needed to build the sitemap index")
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	var body bytes.Buffer
+	body.WriteString(fmt.Sprintf("%s<sitemapindex xmlns=\"%s\">\n", xml.Header, sitemapNamespace))
+	files := []string{index}
+	for i, c := range chunks {
+		name := fmt.Sprintf("%s-%d%s", sitemapFile, i+1, ext)
+		path := filepath.Join(cfg.Dir, name)
+		if err := writeSitemapFile(path, c.body.Bytes(), cfg.Gzip); err != nil {
+			return nil, err
+		}
+		files = append(files, path)
+
+		el, err := xml.Marshal(sitemapRef{Loc: baseURL + "/" + name, LastMod: lastMod(c.lastMod)})
+		if err != nil {
+			return nil, err
+		}
+		body.Write(el)
+		body.WriteByte('\n')
+	}
+	body.WriteString("</sitemapindex>\n")
+	return files, writeSitemapFile(index, body.Bytes(), cfg.Gzip)
+}
@@ -0,0 +1,160 @@
+package export
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/wanna-crawl/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+var fetchedAt = time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+
+func testStorage() storage.Storage {
+	db, _ := storage.NewStorage("in-memory", storage.Config{})
+	pages := []*storage.Page{
+		{URL: "https://example.com/", StatusCode: 200, ContentType: "text/html; charset=utf-8", FetchedAt: fetchedAt},
+		{URL: "https://example.com/a?x=1&y=2", Depth: 1, StatusCode: 200, ContentType: "text/html", FetchedAt: fetchedAt.Add(time.Hour)},
+		{URL: "https://example.com/old", Depth: 1, FinalURL: "https://example.com/b", Redirects: []string{"https://example.com/old"}, StatusCode: 200, ContentType: "text/html", FetchedAt: fetchedAt},
+		{URL: "https://example.com/missing", Depth: 1, StatusCode: 404, ContentType: "text/html", Error: "https://example.com/missing returned status code 404"},
+		{URL: "https://example.com/private", Depth: 1, StatusCode: 200, ContentType: "text/html", FetchedAt: fetchedAt, Noindex: true},
+		{URL: "https://example.com/logo.png", Depth: 1, StatusCode: 200, ContentType: "image/png", FetchedAt: fetchedAt},
+		{URL: "https://external.com/", Depth: 1, StatusCode: 200, ContentType: "text/html", FetchedAt: fetchedAt},
+	}
+	for _, p := range pages {
+		db.Store(p)
+	}
+	return db
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "wanna-crawl-export")
+	assert.Nil(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	return string(content)
+}
+
+func TestSitemap(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	files, err := Sitemap(testStorage(), SitemapConfig{Dir: dir})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "sitemap.xml")}, files)
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>https://example.com/</loc><lastmod>2019-10-01T12:00:00Z</lastmod></url>
+<url><loc>https://example.com/a?x=1&amp;y=2</loc><lastmod>2019-10-01T13:00:00Z</lastmod></url>
+<url><loc>https://example.com/b</loc><lastmod>2019-10-01T12:00:00Z</lastmod></url>
+</urlset>
+`
+	assert.Equal(t, expected, readFile(t, files[0]))
+}
+
+func TestSitemapHosts(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	files, err := Sitemap(testStorage(), SitemapConfig{Dir: dir, Hosts: []string{"external.com"}})
+	assert.Nil(t, err)
+	assert.Contains(t, readFile(t, files[0]), "<loc>https://external.com/</loc>")
+	assert.NotContains(t, readFile(t, files[0]), "https://example.com/")
+}
+
+func TestSitemapIndex(t *testing.T) {
+	testCases := []struct {
+		cfg   SitemapConfig
+		index string
+		files []string
+	}{
+		{
+			cfg: SitemapConfig{MaxURLs: 2},
+			index: `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>https://example.com/sitemap-1.xml</loc><lastmod>2019-10-01T13:00:00Z</lastmod></sitemap>
+<sitemap><loc>https://example.com/sitemap-2.xml</loc><lastmod>2019-10-01T12:00:00Z</lastmod></sitemap>
+</sitemapindex>
+`,
+			files: []string{"sitemap.xml", "sitemap-1.xml", "sitemap-2.xml"},
+		},
+		{
+			// Room for the header, the footer and a single url
+			cfg: SitemapConfig{MaxBytes: 250, BaseURL: "https://cdn.example.com/sitemaps/"},
+			index: `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>https://cdn.example.com/sitemaps/sitemap-1.xml</loc><lastmod>2019-10-01T12:00:00Z</lastmod></sitemap>
+<sitemap><loc>https://cdn.example.com/sitemaps/sitemap-2.xml</loc><lastmod>2019-10-01T13:00:00Z</lastmod></sitemap>
+<sitemap><loc>https://cdn.example.com/sitemaps/sitemap-3.xml</loc><lastmod>2019-10-01T12:00:00Z</lastmod></sitemap>
+</sitemapindex>
+`,
+			files: []string{"sitemap.xml", "sitemap-1.xml", "sitemap-2.xml", "sitemap-3.xml"},
+		},
+	}
+
+	for _, tc := range testCases {
+		dir, cleanup := tempDir(t)
+		defer cleanup()
+
+		tc.cfg.Dir = dir
+		files, err := Sitemap(testStorage(), tc.cfg)
+		assert.Nil(t, err)
+		expected := []string{}
+		for _, f := range tc.files {
+			expected = append(expected, filepath.Join(dir, f))
+		}
+		assert.Equal(t, expected, files)
+		assert.Equal(t, tc.index, readFile(t, files[0]))
+		if tc.cfg.MaxBytes > 0 {
+			for _, f := range files[1:] {
+				assert.True(t, len(readFile(t, f)) <= tc.cfg.MaxBytes, f)
+			}
+		}
+	}
+}
+
+func TestSitemapTooSmall(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	_, err := Sitemap(testStorage(), SitemapConfig{Dir: dir, MaxBytes: 100})
+	assert.EqualError(t, err, fmt.Sprintf("%s does not fit in a sitemap of %d bytes", "https://example.com/", 100))
+}
+
+func TestSitemapGzip(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	files, err := Sitemap(testStorage(), SitemapConfig{Dir: dir, Gzip: true, MaxURLs: 2})
+	assert.Nil(t, err)
+	assert.Len(t, files, 3)
+	assert.Equal(t, filepath.Join(dir, "sitemap.xml.gz"), files[0])
+
+	fd, _ := os.Open(files[0])
+	defer fd.Close()
+	gz, err := gzip.NewReader(fd)
+	assert.Nil(t, err)
+	index, _ := ioutil.ReadAll(gz)
+	assert.Contains(t, string(index), "<loc>https://example.com/sitemap-2.xml.gz</loc>")
+}
+
+func TestSitemapNotWalkable(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	db, _ := storage.NewStorage("jsonl", storage.Config{Path: filepath.Join(dir, "crawl.jsonl")})
+	defer db.(io.Closer).Close()
+	_, err := Sitemap(db, SitemapConfig{Dir: dir})
+	assert.EqualError(t, err, "storage engine doesn't support reading pages back")
+}
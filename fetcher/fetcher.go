@@ -2,22 +2,94 @@ package fetcher
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/fcgravalos/wanna-crawl/robots"
 	logr "github.com/sirupsen/logrus"
 )
 
+// Config represents fetcher configuration
+type Config struct {
+	// HTTP Request connection timeout
+	RequestTimeout time.Duration
+	// User-Agent header sent on every request, also used to match robots.txt groups
+	UserAgent string
+	// Whether or not to honor robots.txt rules
+	RespectRobots bool
+	// Max requests per second sent to a single host, 0 means unlimited. robots.txt `Crawl-delay` can slow it down further
+	HostRateLimit float64
+	// Max number of concurrent requests to a single host, 0 means unlimited
+	MaxInFlightPerHost int
+	// Max number of times a url is requested on transient failures, 1 means no retries
+	MaxAttempts int
+	// Wait before the first retry, doubled on every following attempt
+	RetryBackoff time.Duration
+	// Upper bound for the wait between attempts, longer Retry-After headers are cut down to it. 0 means no upper bound, but Retry-After headers are still cut down to 5m
+	RetryMaxBackoff time.Duration
+	// Fraction, between 0 and 1, of the backoff that is randomly shaved off
+	RetryJitter float64
+	// Max size of a response body in bytes, larger ones are not downloaded. 0 means unlimited
+	MaxBodySize int64
+	// Media types whose bodies are downloaded, like `text/html` or `text/*`. Every type is if empty
+	AllowedContentTypes []string
+}
+
 // Fetcher interface just aims to make other packages easier to test. I don't expect, having multiple implementations
 type Fetcher interface {
-	Fetch(u string) ([]byte, error)
+	Fetch(u string) (*Response, error)
+	// Head is like `Fetch`, but the body is not downloaded
+	Head(u string) (*Response, error)
+}
+
+// Downloader is implemented by fetchers that can also download files which are not web pages, like sitemaps
+type Downloader interface {
+	// Download is like `Fetch`, but the body is downloaded whatever its content type
+	Download(u string) (*Response, error)
 }
 
-// NewHTTPFetcher returns a Fetcher given a `ctx` context and `reqTimeout` timeout parameters
-func NewHTTPFetcher(ctx context.Context, logger *logr.Logger, reqTimeout time.Duration) Fetcher {
-	return &httpFetcher{
+// download returns the `Download` method of `f`, or `Fetch` if it is not a `Downloader`
+func download(f Fetcher) func(string) (*Response, error) {
+	if d, ok := f.(Downloader); ok {
+		return d.Download
+	}
+	return f.Fetch
+}
+
+// NewHTTPFetcher returns a Fetcher given a `ctx` context and a `cfg` configuration
+func NewHTTPFetcher(ctx context.Context, logger *logr.Logger, cfg Config) (Fetcher, error) {
+	if cfg.RetryJitter < 0 || cfg.RetryJitter > 1 {
+		return nil, fmt.Errorf("retry jitter must be between 0 and 1, got %v", cfg.RetryJitter)
+	}
+	client := &http.Client{Timeout: cfg.RequestTimeout}
+
+	var checker robots.Checker
+	if cfg.RespectRobots {
+		checker = robots.NewChecker(ctx, logger, client, cfg.UserAgent)
+	}
+
+	hf := &httpFetcher{
 		ctx,
 		logger,
-		&http.Client{Timeout: reqTimeout},
+		client,
+		checker,
+		cfg,
+	}
+	if checker != nil {
+		// Redirects are checked too, robots.txt files are fetched with a client of their own, so they never are
+		hf.Client = &http.Client{Timeout: cfg.RequestTimeout, CheckRedirect: hf.checkRedirect}
+	}
+
+	var f Fetcher = hf
+
+	// Crawl-delay only applies when robots.txt is honored
+	if cfg.HostRateLimit > 0 || cfg.MaxInFlightPerHost > 0 || checker != nil {
+		f = newPoliteFetcher(ctx, f, checker, cfg)
+	}
+	// Retries go on top, so every attempt is subject to the per host limits
+	if cfg.MaxAttempts > 1 {
+		f = newRetryFetcher(ctx, f, logger, cfg)
 	}
+	return f, nil
 }
@@ -1,10 +1,18 @@
 package fetcher
 
 import (
+	"bufio"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/fcgravalos/wanna-crawl/robots"
 	logr "github.com/sirupsen/logrus"
 )
 
@@ -12,22 +20,155 @@ type httpFetcher struct {
 	ctx context.Context
 	*logr.Logger
 	*http.Client
+	robots robots.Checker
+	Config
 }
 
-func (f *httpFetcher) Fetch(url string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(f.ctx, "GET", url, nil)
+// redirectChain returns the urls that were requested before getting to `resp`, oldest first
+func redirectChain(resp *http.Response) []string {
+	chain := []string{}
+	for r := resp.Request.Response; r != nil; r = r.Request.Response {
+		chain = append([]string{r.Request.URL.String()}, chain...)
+	}
+	return chain
+}
+
+// allowedContentType returns `true` if the media type of `contentType` is in `Config.AllowedContentTypes`
+func (f *httpFetcher) allowedContentType(contentType string) bool {
+	if len(f.AllowedContentTypes) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range f.AllowedContentTypes {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == mediaType || (strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mediaType, allowed[:len(allowed)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// readBody reads the body of `resp`. Bodies whose content type is not allowed, unless `anyType` is set, or larger than
+// `Config.MaxBodySize`, are not read, or not any further once the limit is hit, and the reason is returned instead.
+func (f *httpFetcher) readBody(resp *http.Response, anyType bool) ([]byte, string, error) {
+	r := bufio.NewReaderSize(resp.Body, 512)
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		// Guess it from the first bytes, like browsers do
+		head, _ := r.Peek(512)
+		contentType = http.DetectContentType(head)
+	}
+	if !anyType && !f.allowedContentType(contentType) {
+		return nil, fmt.Sprintf("content type %s is not allowed", contentType), nil
+	}
+	if f.MaxBodySize <= 0 {
+		body, err := ioutil.ReadAll(r)
+		return body, "", err
+	}
+
+	if resp.ContentLength > f.MaxBodySize {
+		return nil, fmt.Sprintf("body of %d bytes exceeds the max body size of %d bytes", resp.ContentLength, f.MaxBodySize), nil
+	}
+	// Content-Length may be missing or wrong, stop reading right after the limit
+	body, err := ioutil.ReadAll(io.LimitReader(r, f.MaxBodySize+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(body)) > f.MaxBodySize {
+		return nil, fmt.Sprintf("body exceeds the max body size of %d bytes", f.MaxBodySize), nil
+	}
+	return body, "", nil
+}
+
+// checkRobots returns an error if robots.txt rules don't allow fetching `url`
+func (f *httpFetcher) checkRobots(url string) error {
+	if f.robots == nil {
+		return nil
+	}
+	allowed, err := f.robots.Allowed(url)
 	if err != nil {
-		f.Debugf("failed to build HTTP GET request: %v", err)
+		f.Debugf("failed to check robots.txt rules: %v", err)
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("%s: %w", url, robots.ErrDisallowed)
+	}
+	return nil
+}
+
+// checkRedirect stops following redirects to urls disallowed by robots.txt, or after 10 of them like
+// `http.Client` does by default
+func (f *httpFetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return f.checkRobots(req.URL.String())
+}
+
+// request sends a `method` request to `url`, only GET responses have a body. `anyType` downloads it whatever its
+// content type
+func (f *httpFetcher) request(method string, url string, anyType bool) (*Response, error) {
+	if err := f.checkRobots(url); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(f.ctx, method, url, nil)
+	if err != nil {
+		f.Debugf("failed to build HTTP %s request: %v", method, err)
 		return nil, err
 	}
+	if f.UserAgent != "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
 
+	start := time.Now()
 	resp, err := f.Do(req)
 	if err != nil {
-		f.Errorf("failed HTTP GET request: %v", err)
+		f.Errorf("failed HTTP %s request: %v", method, err)
 		return nil, err
 	}
 	body := resp.Body
 	defer body.Close()
 
-	return ioutil.ReadAll(body)
+	var page []byte
+	var skipped string
+	if method == http.MethodGet {
+		page, skipped, err = f.readBody(resp, anyType)
+		if err != nil {
+			f.Errorf("failed to read response body: %v", err)
+			return nil, err
+		}
+		if skipped != "" {
+			f.Debugf("skipping %s body: %s", url, skipped)
+		}
+	}
+
+	return &Response{
+		URL:         url,
+		FinalURL:    resp.Request.URL.String(),
+		Redirects:   redirectChain(resp),
+		StatusCode:  resp.StatusCode,
+		Header:      resp.Header,
+		ContentType: resp.Header.Get("Content-Type"),
+		FetchedAt:   start,
+		Latency:     time.Since(start),
+		Body:        page,
+		Skipped:     skipped,
+		Attempts:    1,
+	}, nil
+}
+
+func (f *httpFetcher) Fetch(url string) (*Response, error) {
+	return f.request(http.MethodGet, url, false)
+}
+
+func (f *httpFetcher) Head(url string) (*Response, error) {
+	return f.request(http.MethodHead, url, false)
+}
+
+func (f *httpFetcher) Download(url string) (*Response, error) {
+	return f.request(http.MethodGet, url, true)
 }
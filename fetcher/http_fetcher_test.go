@@ -1,13 +1,16 @@
 package fetcher
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/fcgravalos/wanna-crawl/robots"
 	"github.com/gorilla/mux"
 	logr "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -29,17 +32,180 @@ const fakeResponse = `
 </body>
 </html>`
 
+const fakeRobots = `
+User-agent: *
+Disallow: /private/
+`
+
 var fakeURL string
 
 func TestFetch(t *testing.T) {
 
 	logger := new(logr.Logger)
-	f := NewHTTPFetcher(context.Background(), logger, 1*time.Second)
+	f, _ := NewHTTPFetcher(context.Background(), logger, Config{RequestTimeout: 1 * time.Second})
 
 	response, err := f.Fetch(fakeURL)
 
 	assert.Nil(t, err)
-	assert.Equal(t, []byte(fakeResponse), response)
+	assert.Equal(t, []byte(fakeResponse), response.Body)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, fakeURL, response.FinalURL)
+	assert.Equal(t, "text/html; charset=utf-8", response.ContentType)
+	assert.Empty(t, response.Redirects)
+	assert.True(t, response.OK())
+}
+
+func TestFetchRedirects(t *testing.T) {
+	logger := new(logr.Logger)
+	f, _ := NewHTTPFetcher(context.Background(), logger, Config{RequestTimeout: 1 * time.Second})
+
+	response, err := f.Fetch(fakeURL + "/old")
+
+	assert.Nil(t, err)
+	assert.Equal(t, fakeURL+"/old", response.URL)
+	assert.Equal(t, fakeURL+"/", response.FinalURL)
+	assert.Equal(t, []string{fakeURL + "/old", fakeURL + "/moved"}, response.Redirects)
+	assert.Equal(t, []byte(fakeResponse), response.Body)
+}
+
+func TestHead(t *testing.T) {
+	logger := new(logr.Logger)
+	f, _ := NewHTTPFetcher(context.Background(), logger, Config{RequestTimeout: 1 * time.Second})
+
+	response, err := f.Head(fakeURL + "/old")
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, fakeURL+"/", response.FinalURL)
+	assert.Equal(t, []string{fakeURL + "/old", fakeURL + "/moved"}, response.Redirects)
+	assert.Empty(t, response.Body)
+}
+
+func TestFetchNotFound(t *testing.T) {
+	logger := new(logr.Logger)
+	f, _ := NewHTTPFetcher(context.Background(), logger, Config{RequestTimeout: 1 * time.Second})
+
+	response, err := f.Fetch(fakeURL + "/missing")
+
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	assert.False(t, response.OK())
+}
+
+func TestFetchRespectsRobots(t *testing.T) {
+	logger := new(logr.Logger)
+	cfg := Config{
+		RequestTimeout: 1 * time.Second,
+		UserAgent:      "wanna-crawl",
+		RespectRobots:  true,
+	}
+	f, _ := NewHTTPFetcher(context.Background(), logger, cfg)
+
+	response, err := f.Fetch(fakeURL + "/private/secret")
+	assert.True(t, errors.Is(err, robots.ErrDisallowed))
+	assert.Nil(t, response)
+
+	response, err = f.Fetch(fakeURL)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(fakeResponse), response.Body)
+
+	response, err = f.Head(fakeURL + "/private/secret")
+	assert.True(t, errors.Is(err, robots.ErrDisallowed))
+	assert.Nil(t, response)
+
+	// Redirects into disallowed urls are not followed, the rest are
+	response, err = f.Fetch(fakeURL + "/leak")
+	assert.True(t, errors.Is(err, robots.ErrDisallowed))
+	assert.Nil(t, response)
+
+	response, err = f.Fetch(fakeURL + "/old")
+	assert.Nil(t, err)
+	assert.Equal(t, fakeURL+"/", response.FinalURL)
+}
+
+func TestFetchContentTypes(t *testing.T) {
+	logger := new(logr.Logger)
+	testCases := []struct {
+		allowed []string
+		path    string
+		skipped string
+	}{
+		{nil, "/logo.png", ""},
+		{[]string{"text/html"}, "/", ""},
+		{[]string{"TEXT/HTML"}, "/", ""},
+		{[]string{"text/*"}, "/", ""},
+		{[]string{"text/html"}, "/logo.png", "content type image/png is not allowed"},
+		{[]string{"text/html", "image/*"}, "/logo.png", ""},
+		// Missing content types are guessed from the body
+		{[]string{"text/html"}, "/untyped", ""},
+		{[]string{"text/plain"}, "/untyped", "content type text/html; charset=utf-8 is not allowed"},
+	}
+
+	for _, tc := range testCases {
+		f, _ := NewHTTPFetcher(context.Background(), logger, Config{RequestTimeout: 1 * time.Second, AllowedContentTypes: tc.allowed})
+		response, err := f.Fetch(fakeURL + tc.path)
+		assert.Nil(t, err, tc.path)
+		assert.Equal(t, http.StatusOK, response.StatusCode, tc.path)
+		assert.Equal(t, tc.skipped, response.Skipped, tc.path)
+		if tc.skipped == "" {
+			assert.NotEmpty(t, response.Body, tc.path)
+		} else {
+			assert.Empty(t, response.Body, tc.path)
+		}
+	}
+}
+
+func TestDownload(t *testing.T) {
+	// Every decorator passes downloads through
+	f, _ := NewHTTPFetcher(context.Background(), new(logr.Logger), Config{
+		RequestTimeout:      1 * time.Second,
+		HostRateLimit:       100,
+		MaxAttempts:         2,
+		AllowedContentTypes: []string{"text/html"},
+	})
+	response, err := f.Fetch(fakeURL + "/logo.png")
+	assert.Nil(t, err)
+	assert.Empty(t, response.Body)
+
+	response, err = f.(Downloader).Download(fakeURL + "/logo.png")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Empty(t, response.Skipped)
+	assert.NotEmpty(t, response.Body)
+}
+
+func TestFetchMaxBodySize(t *testing.T) {
+	logger := new(logr.Logger)
+	testCases := []struct {
+		max     int64
+		path    string
+		skipped string
+	}{
+		{0, "/big", ""},
+		{4096, "/big", ""},
+		{4095, "/big", "body of 4096 bytes exceeds the max body size of 4095 bytes"},
+		// Without Content-Length the body is read up to the limit
+		{4096, "/stream", ""},
+		{1024, "/stream", "body exceeds the max body size of 1024 bytes"},
+	}
+
+	for _, tc := range testCases {
+		f, _ := NewHTTPFetcher(context.Background(), logger, Config{RequestTimeout: 1 * time.Second, MaxBodySize: tc.max})
+		response, err := f.Fetch(fakeURL + tc.path)
+		assert.Nil(t, err, tc.path)
+		assert.Equal(t, tc.skipped, response.Skipped, tc.path)
+		if tc.skipped == "" {
+			assert.Len(t, response.Body, 4096, tc.path)
+		} else {
+			assert.Empty(t, response.Body, tc.path)
+		}
+	}
+
+	// Checking a url is alive never downloads it
+	f, _ := NewHTTPFetcher(context.Background(), logger, Config{RequestTimeout: 1 * time.Second, MaxBodySize: 1024, AllowedContentTypes: []string{"image/png"}})
+	response, err := f.Head(fakeURL + "/big")
+	assert.Nil(t, err)
+	assert.Empty(t, response.Skipped)
 }
 
 func TestMain(m *testing.M) {
@@ -47,9 +213,54 @@ func TestMain(m *testing.M) {
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(fakeResponse))
 	})
+	r.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/moved", http.StatusMovedPermanently)
+	})
+	r.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/", http.StatusFound)
+	})
+	r.HandleFunc("/leak", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/private/secret", http.StatusFound)
+	})
+	r.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fakeRobots))
+	})
+	r.HandleFunc("/private/secret", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secret"))
+	})
+	r.HandleFunc("/logo.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	})
+	r.HandleFunc("/untyped", func(w http.ResponseWriter, r *http.Request) {
+		// Keeps the server from sniffing it
+		w.Header()["Content-Type"] = nil
+		w.Write([]byte(fakeResponse))
+	})
+	r.HandleFunc("/big", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "4096")
+		w.Write(bytes.Repeat([]byte("a"), 4096))
+	})
+	r.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 4; i++ {
+			w.Write(bytes.Repeat([]byte("a"), 1024))
+			w.(http.Flusher).Flush()
+		}
+	})
 
 	server := httptest.NewServer(r)
 	fakeURL = server.URL
 	defer server.Close()
 	os.Exit(m.Run())
 }
+
+func TestNewHTTPFetcherValidatesJitter(t *testing.T) {
+	logger := new(logr.Logger)
+	for _, jitter := range []float64{-0.1, 1.5} {
+		f, err := NewHTTPFetcher(context.Background(), logger, Config{RetryJitter: jitter})
+		assert.NotNil(t, err)
+		assert.Nil(t, f)
+	}
+	_, err := NewHTTPFetcher(context.Background(), logger, Config{RetryJitter: 1})
+	assert.Nil(t, err)
+}
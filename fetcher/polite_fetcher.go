@@ -0,0 +1,143 @@
+package fetcher
+
+import (
+	"context"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"github.com/fcgravalos/wanna-crawl/robots"
+)
+
+// hostLimiter throttles the requests sent to a single host
+type hostLimiter struct {
+	// Bounds the number of in-flight requests, nil means unbounded
+	slots chan struct{}
+
+	sync.Mutex
+	// Earliest time the next request is allowed to start
+	next time.Time
+}
+
+// acquire blocks until a request to the host can be sent, spacing requests at least `interval` apart
+func (h *hostLimiter) acquire(ctx context.Context, interval time.Duration) error {
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if interval <= 0 {
+		return nil
+	}
+
+	// Reserve a start time, so concurrent callers queue up instead of firing together
+	h.Lock()
+	now := time.Now()
+	at := h.next
+	if at.Before(now) {
+		at = now
+	}
+	h.next = at.Add(interval)
+	h.Unlock()
+
+	wait := time.Until(at)
+	if wait <= 0 {
+		return nil
+	}
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		h.release()
+		return ctx.Err()
+	}
+}
+
+func (h *hostLimiter) release() {
+	if h.slots != nil {
+		<-h.slots
+	}
+}
+
+// politeFetcher wraps a `Fetcher` enforcing per host rate and concurrency limits.
+// Limits are tracked per host, so waiting on a busy host does not delay requests to other hosts.
+type politeFetcher struct {
+	ctx context.Context
+	Fetcher
+	robots robots.Checker
+	Config
+
+	sync.Mutex
+	hosts map[string]*hostLimiter
+}
+
+func (f *politeFetcher) limiter(host string) *hostLimiter {
+	f.Lock()
+	defer f.Unlock()
+	h, ok := f.hosts[host]
+	if !ok {
+		h = &hostLimiter{}
+		if f.MaxInFlightPerHost > 0 {
+			h.slots = make(chan struct{}, f.MaxInFlightPerHost)
+		}
+		f.hosts[host] = h
+	}
+	return h
+}
+
+// interval returns the minimum time between two requests to `url` host,
+// the largest of the configured rate and the robots.txt `Crawl-delay`
+func (f *politeFetcher) interval(url string) time.Duration {
+	var interval time.Duration
+	if f.HostRateLimit > 0 {
+		interval = time.Duration(float64(time.Second) / f.HostRateLimit)
+	}
+	if f.robots != nil {
+		if delay, err := f.robots.CrawlDelay(url); err == nil && delay > interval {
+			interval = delay
+		}
+	}
+	return interval
+}
+
+// limit calls `fetch` for `url` once its host limits allow it
+func (f *politeFetcher) limit(url string, fetch func(string) (*Response, error)) (*Response, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	h := f.limiter(u.Host)
+	if err := h.acquire(f.ctx, f.interval(url)); err != nil {
+		return nil, err
+	}
+	defer h.release()
+
+	return fetch(url)
+}
+
+func (f *politeFetcher) Fetch(url string) (*Response, error) {
+	return f.limit(url, f.Fetcher.Fetch)
+}
+
+func (f *politeFetcher) Head(url string) (*Response, error) {
+	return f.limit(url, f.Fetcher.Head)
+}
+
+func (f *politeFetcher) Download(url string) (*Response, error) {
+	return f.limit(url, download(f.Fetcher))
+}
+
+func newPoliteFetcher(ctx context.Context, f Fetcher, checker robots.Checker, cfg Config) Fetcher {
+	return &politeFetcher{
+		ctx:     ctx,
+		Fetcher: f,
+		robots:  checker,
+		Config:  cfg,
+		hosts:   make(map[string]*hostLimiter),
+	}
+}
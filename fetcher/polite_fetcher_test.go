@@ -0,0 +1,129 @@
+package fetcher
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowFetcher takes `delay` to answer and records the max number of concurrent fetches
+type slowFetcher struct {
+	delay    time.Duration
+	inFlight int32
+	maxSeen  int32
+}
+
+func (s *slowFetcher) Fetch(url string) (*Response, error) {
+	n := atomic.AddInt32(&s.inFlight, 1)
+	for {
+		max := atomic.LoadInt32(&s.maxSeen)
+		if n <= max || atomic.CompareAndSwapInt32(&s.maxSeen, max, n) {
+			break
+		}
+	}
+	time.Sleep(s.delay)
+	atomic.AddInt32(&s.inFlight, -1)
+	return &Response{URL: url, StatusCode: 200}, nil
+}
+
+func (s *slowFetcher) Head(url string) (*Response, error) {
+	return s.Fetch(url)
+}
+
+type fakeRobotsChecker struct {
+	delay time.Duration
+}
+
+func (f *fakeRobotsChecker) Allowed(u string) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeRobotsChecker) CrawlDelay(u string) (time.Duration, error) {
+	return f.delay, nil
+}
+
+func fetchAll(f Fetcher, urls []string) {
+	var wg sync.WaitGroup
+	for _, u := range urls {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			f.Fetch(u)
+		}(u)
+	}
+	wg.Wait()
+}
+
+func TestPoliteFetcherMaxInFlight(t *testing.T) {
+	slow := &slowFetcher{delay: 20 * time.Millisecond}
+	f := newPoliteFetcher(context.Background(), slow, nil, Config{MaxInFlightPerHost: 2})
+
+	fetchAll(f, []string{
+		"https://wanna-crawl.com/1",
+		"https://wanna-crawl.com/2",
+		"https://wanna-crawl.com/3",
+		"https://wanna-crawl.com/4",
+		"https://wanna-crawl.com/5",
+		"https://wanna-crawl.com/6",
+	})
+	assert.Equal(t, int32(2), atomic.LoadInt32(&slow.maxSeen))
+}
+
+func TestPoliteFetcherRateLimit(t *testing.T) {
+	slow := &slowFetcher{}
+	f := newPoliteFetcher(context.Background(), slow, nil, Config{HostRateLimit: 20})
+
+	start := time.Now()
+	fetchAll(f, []string{
+		"https://wanna-crawl.com/1",
+		"https://wanna-crawl.com/2",
+		"https://wanna-crawl.com/3",
+		"https://wanna-crawl.com/4",
+	})
+	// First request goes straight away, the other three are spaced 50ms apart
+	assert.True(t, time.Since(start) >= 150*time.Millisecond)
+}
+
+func TestPoliteFetcherCrawlDelay(t *testing.T) {
+	slow := &slowFetcher{}
+	f := newPoliteFetcher(context.Background(), slow, &fakeRobotsChecker{delay: 50 * time.Millisecond}, Config{HostRateLimit: 1000})
+
+	start := time.Now()
+	fetchAll(f, []string{
+		"https://wanna-crawl.com/1",
+		"https://wanna-crawl.com/2",
+		"https://wanna-crawl.com/3",
+	})
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestPoliteFetcherHostsAreIndependent(t *testing.T) {
+	slow := &slowFetcher{}
+	f := newPoliteFetcher(context.Background(), slow, nil, Config{HostRateLimit: 1, MaxInFlightPerHost: 1})
+
+	start := time.Now()
+	fetchAll(f, []string{
+		"https://wanna-crawl.com/",
+		"https://external.com/",
+		"https://community.wanna-crawl.com/",
+	})
+	// Every host gets its first request immediately
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
+
+func TestPoliteFetcherContextCanceled(t *testing.T) {
+	slow := &slowFetcher{}
+	ctx, cancel := context.WithCancel(context.Background())
+	f := newPoliteFetcher(ctx, slow, nil, Config{HostRateLimit: 0.1})
+
+	_, err := f.Fetch("https://wanna-crawl.com/1")
+	assert.Nil(t, err)
+
+	cancel()
+	_, err = f.Fetch("https://wanna-crawl.com/2")
+	assert.Equal(t, context.Canceled, err)
+}
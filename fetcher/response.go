@@ -0,0 +1,37 @@
+package fetcher
+
+import (
+	"net/http"
+	"time"
+)
+
+// Response holds everything we know about a fetched url
+type Response struct {
+	// The requested url
+	URL string
+	// The url the content was served from, after following redirects
+	FinalURL string
+	// Urls visited before reaching `FinalURL`, in order
+	Redirects []string
+	// HTTP status code of the final response
+	StatusCode int
+	// Headers of the final response
+	Header http.Header
+	// Value of the Content-Type header
+	ContentType string
+	// When the request was sent
+	FetchedAt time.Time
+	// Time spent since the request was sent until the whole body was read
+	Latency time.Duration
+	// Response body
+	Body []byte
+	// Why the body was not downloaded, empty if it was
+	Skipped string
+	// Number of times the url was requested to get this response
+	Attempts int
+}
+
+// OK returns `true` if the response has a 2xx status code
+func (r *Response) OK() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
@@ -0,0 +1,174 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/fcgravalos/wanna-crawl/robots"
+	logr "github.com/sirupsen/logrus"
+)
+
+// Status codes worth trying again, the server might answer differently in a while
+var retryableStatus = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// Upper bound for Retry-After headers when there is no max backoff, so a server can not stall a worker for days
+var maxRetryAfter = 5 * time.Minute
+
+// retryAfter parses the Retry-After header of 429 and 503 responses, either in seconds or as an HTTP date
+func retryAfter(resp *Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// retryFetcher wraps a `Fetcher` trying again transient failures with exponential backoff and jitter
+type retryFetcher struct {
+	ctx context.Context
+	Fetcher
+	*logr.Logger
+	Config
+}
+
+// retryable returns `true` if the outcome of a fetch is a transient failure
+func (f *retryFetcher) retryable(resp *Response, err error) bool {
+	if err == nil {
+		return resp != nil && retryableStatus[resp.StatusCode]
+	}
+	if f.ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	// Timeouts, connection resets and refused connections, whether they happen sending the request or reading the body.
+	// Every error of the HTTP client is a `net.Error`, so unknown hosts or bad certificates are not retried this way.
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// robots.txt might be back by the next attempt
+	return errors.Is(err, robots.ErrUnavailable)
+}
+
+// backoff returns how long to wait after the `attempt`-th failed attempt
+func (f *retryFetcher) backoff(attempt int) time.Duration {
+	wait := f.RetryBackoff
+	// Doubling stops at the max backoff, or before overflowing when there is none
+	for i := 1; i < attempt && (f.RetryMaxBackoff <= 0 || wait < f.RetryMaxBackoff) && wait < math.MaxInt64/2; i++ {
+		wait *= 2
+	}
+	if f.RetryMaxBackoff > 0 && wait > f.RetryMaxBackoff {
+		wait = f.RetryMaxBackoff
+	}
+	// Spread retries so workers failing together do not come back together
+	if f.RetryJitter > 0 {
+		wait -= time.Duration(f.RetryJitter * rand.Float64() * float64(wait))
+	}
+	return wait
+}
+
+func (f *retryFetcher) sleep(d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-f.ctx.Done():
+		return f.ctx.Err()
+	}
+}
+
+// retry calls `fetch` for `url` until it succeeds, fails for good or runs out of attempts
+func (f *retryFetcher) retry(url string, fetch func(string) (*Response, error)) (*Response, error) {
+	var resp *Response
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		resp, err = fetch(url)
+		if resp != nil {
+			resp.Attempts = attempt
+		}
+		if attempt >= f.MaxAttempts || !f.retryable(resp, err) {
+			break
+		}
+
+		wait := f.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				limit := f.RetryMaxBackoff
+				if limit <= 0 {
+					limit = maxRetryAfter
+				}
+				if after > limit {
+					f.Debugf("%s asked to retry after %v, longer than the max backoff, waiting %v", url, after, limit)
+					after = limit
+				}
+				if after > wait {
+					wait = after
+				}
+			}
+		}
+
+		f.Debugf("attempt %d for %s failed, retrying in %v", attempt, url, wait)
+		if err := f.sleep(wait); err != nil {
+			break
+		}
+	}
+
+	if err != nil && attempt > 1 {
+		err = fmt.Errorf("giving up on %s after %d attempts: %w", url, attempt, err)
+	}
+	return resp, err
+}
+
+func (f *retryFetcher) Fetch(url string) (*Response, error) {
+	return f.retry(url, f.Fetcher.Fetch)
+}
+
+func (f *retryFetcher) Head(url string) (*Response, error) {
+	return f.retry(url, f.Fetcher.Head)
+}
+
+func (f *retryFetcher) Download(url string) (*Response, error) {
+	return f.retry(url, download(f.Fetcher))
+}
+
+func newRetryFetcher(ctx context.Context, f Fetcher, logger *logr.Logger, cfg Config) Fetcher {
+	return &retryFetcher{
+		ctx,
+		f,
+		logger,
+		cfg,
+	}
+}
@@ -0,0 +1,221 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fcgravalos/wanna-crawl/robots"
+	logr "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyFetcher answers with the `outcomes` in order, repeating the last one
+type flakyFetcher struct {
+	outcomes []func() (*Response, error)
+	calls    int
+}
+
+func (f *flakyFetcher) Fetch(url string) (*Response, error) {
+	i := f.calls
+	if i >= len(f.outcomes) {
+		i = len(f.outcomes) - 1
+	}
+	f.calls++
+	return f.outcomes[i]()
+}
+
+func (f *flakyFetcher) Head(url string) (*Response, error) {
+	return f.Fetch(url)
+}
+
+func withStatus(code int, header http.Header) func() (*Response, error) {
+	return func() (*Response, error) {
+		if header == nil {
+			header = http.Header{}
+		}
+		return &Response{StatusCode: code, Header: header, Attempts: 1}, nil
+	}
+}
+
+func withError(err error) func() (*Response, error) {
+	return func() (*Response, error) {
+		return nil, err
+	}
+}
+
+var retryCfg = Config{
+	MaxAttempts:     3,
+	RetryBackoff:    time.Millisecond,
+	RetryMaxBackoff: 10 * time.Millisecond,
+	RetryJitter:     0.5,
+}
+
+func TestRetryFetcherRecovers(t *testing.T) {
+	reset := &url.Error{Op: "Get", URL: "https://wanna-crawl.com/", Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}}
+	flaky := &flakyFetcher{outcomes: []func() (*Response, error){
+		withError(reset),
+		withStatus(http.StatusBadGateway, nil),
+		withStatus(http.StatusOK, nil),
+	}}
+	f := newRetryFetcher(context.Background(), flaky, new(logr.Logger), retryCfg)
+
+	resp, err := f.Fetch("https://wanna-crawl.com/")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, resp.Attempts)
+	assert.Equal(t, 3, flaky.calls)
+
+	// HEAD requests are retried the same way
+	flaky.calls = 0
+	resp, err = f.Head("https://wanna-crawl.com/")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 3, resp.Attempts)
+}
+
+func TestRetryFetcherRobotsUnavailable(t *testing.T) {
+	// robots.txt might be back by the next attempt
+	flaky := &flakyFetcher{outcomes: []func() (*Response, error){
+		withError(fmt.Errorf("%w: https://wanna-crawl.com/robots.txt returned status code 503", robots.ErrUnavailable)),
+		withStatus(http.StatusOK, nil),
+	}}
+	f := newRetryFetcher(context.Background(), flaky, new(logr.Logger), retryCfg)
+
+	resp, err := f.Fetch("https://wanna-crawl.com/")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, flaky.calls)
+}
+
+func TestRetryFetcherGivesUp(t *testing.T) {
+	flaky := &flakyFetcher{outcomes: []func() (*Response, error){
+		withStatus(http.StatusServiceUnavailable, nil),
+	}}
+	f := newRetryFetcher(context.Background(), flaky, new(logr.Logger), retryCfg)
+
+	resp, err := f.Fetch("https://wanna-crawl.com/")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, 3, resp.Attempts)
+
+	timeout := &url.Error{Op: "Get", URL: "https://wanna-crawl.com/", Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true}}
+	flaky = &flakyFetcher{outcomes: []func() (*Response, error){withError(timeout)}}
+	f = newRetryFetcher(context.Background(), flaky, new(logr.Logger), retryCfg)
+
+	resp, err = f.Fetch("https://wanna-crawl.com/")
+	assert.Nil(t, resp)
+	assert.True(t, errors.As(err, new(net.Error)))
+	assert.Contains(t, err.Error(), "after 3 attempts")
+	assert.Equal(t, 3, flaky.calls)
+}
+
+func TestRetryFetcherNotRetryable(t *testing.T) {
+	testCases := []func() (*Response, error){
+		withStatus(http.StatusNotFound, nil),
+		withStatus(http.StatusOK, nil),
+		withError(fmt.Errorf("https://wanna-crawl.com/: %w", robots.ErrDisallowed)),
+		withError(context.Canceled),
+		withError(&url.Error{Op: "Get", URL: "https://gone.wanna-crawl.com/", Err: &net.DNSError{Err: "no such host", Name: "gone.wanna-crawl.com", IsNotFound: true}}),
+	}
+	for _, outcome := range testCases {
+		flaky := &flakyFetcher{outcomes: []func() (*Response, error){outcome}}
+		f := newRetryFetcher(context.Background(), flaky, new(logr.Logger), retryCfg)
+		f.Fetch("https://wanna-crawl.com/")
+		assert.Equal(t, 1, flaky.calls)
+	}
+}
+
+func TestRetryFetcherRetryAfter(t *testing.T) {
+	// Retry-After over the max backoff is cut down to it
+	flaky := &flakyFetcher{outcomes: []func() (*Response, error){
+		withStatus(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"120"}}),
+		withStatus(http.StatusOK, nil),
+	}}
+	f := newRetryFetcher(context.Background(), flaky, new(logr.Logger), retryCfg)
+
+	start := time.Now()
+	resp, _ := f.Fetch("https://wanna-crawl.com/")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, flaky.calls)
+	assert.True(t, time.Since(start) < time.Second)
+
+	// Retry-After within the max backoff is honored
+	cfg := retryCfg
+	cfg.RetryMaxBackoff = 2 * time.Second
+	flaky = &flakyFetcher{outcomes: []func() (*Response, error){
+		withStatus(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"1"}}),
+		withStatus(http.StatusOK, nil),
+	}}
+	f = newRetryFetcher(context.Background(), flaky, new(logr.Logger), cfg)
+
+	start = time.Now()
+	resp, _ = f.Fetch("https://wanna-crawl.com/")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, time.Since(start) >= time.Second)
+
+	// Without a max backoff Retry-After is still cut down, to `maxRetryAfter`
+	defer func(d time.Duration) { maxRetryAfter = d }(maxRetryAfter)
+	maxRetryAfter = 10 * time.Millisecond
+	cfg.RetryMaxBackoff = 0
+	flaky = &flakyFetcher{outcomes: []func() (*Response, error){
+		withStatus(http.StatusServiceUnavailable, http.Header{"Retry-After": []string{"86400"}}),
+		withStatus(http.StatusOK, nil),
+	}}
+	f = newRetryFetcher(context.Background(), flaky, new(logr.Logger), cfg)
+
+	start = time.Now()
+	resp, _ = f.Fetch("https://wanna-crawl.com/")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, flaky.calls)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestRetryAfter(t *testing.T) {
+	testCases := []struct {
+		status   int
+		header   string
+		expected time.Duration
+		ok       bool
+	}{
+		{http.StatusTooManyRequests, "5", 5 * time.Second, true},
+		{http.StatusServiceUnavailable, "0", 0, true},
+		{http.StatusServiceUnavailable, "Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+		{http.StatusServiceUnavailable, "", 0, false},
+		{http.StatusServiceUnavailable, "soon", 0, false},
+		{http.StatusInternalServerError, "5", 0, false},
+	}
+	for _, tc := range testCases {
+		d, ok := retryAfter(&Response{StatusCode: tc.status, Header: http.Header{"Retry-After": []string{tc.header}}})
+		assert.Equal(t, tc.expected, d)
+		assert.Equal(t, tc.ok, ok)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cfg := Config{RetryBackoff: 100 * time.Millisecond, RetryMaxBackoff: time.Second}
+	f := &retryFetcher{Config: cfg}
+
+	assert.Equal(t, 100*time.Millisecond, f.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, f.backoff(2))
+	assert.Equal(t, 800*time.Millisecond, f.backoff(4))
+	assert.Equal(t, time.Second, f.backoff(10))
+
+	// No max backoff means no upper bound
+	f.RetryMaxBackoff = 0
+	assert.Equal(t, 800*time.Millisecond, f.backoff(4))
+	assert.Equal(t, 51200*time.Millisecond, f.backoff(10))
+	f.RetryMaxBackoff = time.Second
+
+	f.RetryJitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := f.backoff(2)
+		assert.True(t, d > 100*time.Millisecond && d <= 200*time.Millisecond)
+	}
+}
@@ -0,0 +1,175 @@
+package frontier
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fcgravalos/wanna-crawl/seen"
+	"github.com/fcgravalos/wanna-crawl/storage"
+)
+
+const (
+	stateFile   = "frontier.json"
+	seenFile    = "seen.json"
+	storageFile = "storage.json"
+)
+
+// PendingURL is a url that was seen but not crawled when the checkpoint was taken
+type PendingURL struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+	Seed  string `json:"seed"`
+	// Whether the url is only checked, not crawled
+	Check bool `json:"check,omitempty"`
+}
+
+// State is what the frontier needs to resume a crawl
+type State struct {
+	// Seeds whose frontier server had not started yet
+	Seeds []string `json:"seeds"`
+	// Urls already seen but not crawled yet
+	Pending []PendingURL `json:"pending"`
+}
+
+// writeFile replaces `path` with what `write` produces, so a crash never leaves a half written checkpoint
+func writeFile(path string, write func(w io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func readFile(path string, read func(r io.Reader) error) error {
+	fd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return read(fd)
+}
+
+// snapshot returns the current frontier `State`. Callers must hold `f.state` for writing.
+func (f *Frontier) snapshot() *State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state := &State{Seeds: []string{}, Pending: []PendingURL{}}
+	for seed := range f.waiting {
+		state.Seeds = append(state.Seeds, seed)
+	}
+	for _, j := range f.pending {
+		state.Pending = append(state.Pending, PendingURL{URL: j.url, Depth: j.depth, Seed: j.seed, Check: j.check})
+	}
+	sort.Strings(state.Seeds)
+	sort.Slice(state.Pending, func(i, k int) bool { return state.Pending[i].URL < state.Pending[k].URL })
+	return state
+}
+
+// Checkpoint saves the pending urls, the seen cache and the stored results into `CheckpointDir`.
+// Seen and storage engines that don't implement `Persistent` are skipped, since they are expected to outlive the process.
+func (f *Frontier) Checkpoint() error {
+	if err := os.MkdirAll(f.CheckpointDir, 0755); err != nil {
+		return err
+	}
+
+	// Stop managers while saving, so the frontier state, the seen cache and the storage agree with each other
+	f.state.Lock()
+	defer f.state.Unlock()
+
+	state := f.snapshot()
+	err := writeFile(filepath.Join(f.CheckpointDir, stateFile), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(state)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save frontier state: %w", err)
+	}
+
+	if p, ok := f.Cache.(seen.Persistent); ok {
+		if err := writeFile(filepath.Join(f.CheckpointDir, seenFile), p.Save); err != nil {
+			return fmt.Errorf("failed to save seen cache: %w", err)
+		}
+	}
+
+	if p, ok := f.Storage.(storage.Persistent); ok {
+		if err := writeFile(filepath.Join(f.CheckpointDir, storageFile), p.Save); err != nil {
+			return fmt.Errorf("failed to save storage: %w", err)
+		}
+	}
+
+	f.Debugf("checkpoint saved, %d urls pending and %d seeds waiting", len(state.Pending), len(state.Seeds))
+	return nil
+}
+
+// StartCheckpointing saves a checkpoint every `CheckpointInterval` until the context is canceled
+func (f *Frontier) StartCheckpointing() {
+	ticker := time.NewTicker(f.CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := f.Checkpoint(); err != nil {
+				f.Errorf("failed to save checkpoint: %v", err)
+			}
+		case <-f.ctx.Done():
+			return
+		}
+	}
+}
+
+// Restore loads the seen cache and the storage saved in `CheckpointDir` and returns the frontier `State`
+func (f *Frontier) Restore() (*State, error) {
+	state := &State{}
+	err := readFile(filepath.Join(f.CheckpointDir, stateFile), func(r io.Reader) error {
+		return json.NewDecoder(r).Decode(state)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load frontier state: %w", err)
+	}
+
+	if p, ok := f.Cache.(seen.Persistent); ok {
+		if err := readFile(filepath.Join(f.CheckpointDir, seenFile), p.Load); err != nil {
+			return nil, fmt.Errorf("failed to load seen cache: %w", err)
+		}
+	}
+
+	if p, ok := f.Storage.(storage.Persistent); ok {
+		if err := readFile(filepath.Join(f.CheckpointDir, storageFile), p.Load); err != nil {
+			return nil, fmt.Errorf("failed to load storage: %w", err)
+		}
+	}
+	return state, nil
+}
+
+// ResumeManager continues the crawl saved in `state`, as returned by `Restore`, and will wait for the result
+func (f *Frontier) ResumeManager(state *State, done chan struct{}) {
+	resumed := map[string][]job{}
+	f.mu.Lock()
+	for _, p := range state.Pending {
+		j := job{url: p.URL, depth: p.Depth, seed: p.Seed, check: p.Check}
+		f.pending[p.URL] = j
+		resumed[p.Seed] = append(resumed[p.Seed], j)
+	}
+	f.mu.Unlock()
+
+	f.startManager(state.Seeds, resumed, done)
+}
@@ -0,0 +1,111 @@
+package frontier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	neturl "net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/fcgravalos/wanna-crawl/crawler"
+	"github.com/fcgravalos/wanna-crawl/seen"
+	"github.com/fcgravalos/wanna-crawl/storage"
+	logr "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpointAndResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wanna-crawl-checkpoint")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := Config{
+		MaxPoolSize:      2,
+		MaxConcurrency:   4,
+		MaxDepth:         10,
+		PublishQueueSize: 1024,
+		CheckpointDir:    dir,
+	}
+	logger := new(logr.Logger)
+	seeds := []string{"https://wanna-crawl.com/", "https://other.wanna-crawl.com/"}
+
+	// First run gets interrupted halfway
+	ctx, cancel := context.WithCancel(context.Background())
+	db, _ := storage.NewStorage("in-memory", storage.Config{})
+	seenCache, _ := seen.NewCache("in-memory", seen.Config{})
+	served := site("https://wanna-crawl.com")
+	for u, p := range site("https://other.wanna-crawl.com") {
+		served[u] = p
+	}
+	interrupting := newFakeFetcher(served)
+	interrupting.before = func(url string) {
+		// As a SIGTERM would
+		if strings.HasSuffix(url, "/b/1") {
+			cancel()
+		}
+	}
+	c := crawler.NewCrawler(interrupting, logger, crawler.Config{Scope: crawler.ScopeAll})
+	f := NewFrontier(ctx, seenCache, db, c, logger, Config{MaxPoolSize: 1, MaxConcurrency: 4, MaxDepth: 10, PublishQueueSize: 1024, CheckpointDir: dir})
+
+	done := make(chan struct{}, 1)
+	f.StartManager(seeds, done)
+	<-done
+	assert.Nil(t, f.Checkpoint())
+
+	state := f.snapshot()
+	assert.NotEmpty(t, state.Pending)
+	assert.Equal(t, []string{"https://other.wanna-crawl.com/"}, state.Seeds)
+
+	// Second run starts from scratch and picks up from the checkpoint
+	db, _ = storage.NewStorage("in-memory", storage.Config{})
+	seenCache, _ = seen.NewCache("in-memory", seen.Config{})
+	c = crawler.NewCrawler(newFakeFetcher(served), logger, crawler.Config{Scope: crawler.ScopeAll})
+	f = NewFrontier(context.Background(), seenCache, db, c, logger, cfg)
+
+	restored, err := f.Restore()
+	assert.Nil(t, err)
+	assert.Equal(t, state, restored)
+
+	done = make(chan struct{}, 1)
+	f.ResumeManager(restored, done)
+	<-done
+
+	// Same result as an uninterrupted crawl
+	expected := map[string]int{"/": 0, "/a": 1, "/b": 1, "/a/1": 2, "/shared": 2, "/b/1": 2, "/a/1/x": 3, "/shared/child": 3, "/deep": 4}
+	pages := map[string]storage.Page{}
+	sitemap, _ := db.Dump()
+	assert.Nil(t, json.Unmarshal([]byte(sitemap), &pages))
+	main, other := map[string]int{}, map[string]int{}
+	for u, p := range pages {
+		assert.Empty(t, p.Error, u)
+		parsed, _ := neturl.Parse(u)
+		if parsed.Host == "wanna-crawl.com" {
+			main[parsed.Path] = p.Depth
+		} else {
+			other[parsed.Path] = p.Depth
+		}
+	}
+	assert.Equal(t, expected, main)
+	assert.Equal(t, expected, other)
+
+	// Nothing left to do
+	assert.Nil(t, f.Checkpoint())
+	restored, err = f.Restore()
+	assert.Nil(t, err)
+	assert.Empty(t, restored.Pending)
+	assert.Empty(t, restored.Seeds)
+}
+
+func TestRestoreMissingCheckpoint(t *testing.T) {
+	logger := new(logr.Logger)
+	db, _ := storage.NewStorage("in-memory", storage.Config{})
+	seenCache, _ := seen.NewCache("in-memory", seen.Config{})
+	c := crawler.NewCrawler(newFakeFetcher(nil), logger, crawler.Config{})
+	f := NewFrontier(context.Background(), seenCache, db, c, logger, Config{CheckpointDir: "/does/not/exist"})
+
+	_, err := f.Restore()
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
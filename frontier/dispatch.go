@@ -0,0 +1,80 @@
+package frontier
+
+import (
+	neturl "net/url"
+)
+
+// hostOf returns the host of `u`, or an empty one if it can not be parsed
+func hostOf(u string) string {
+	parsed, err := neturl.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
+
+// hostQueues holds the jobs of a depth level queued by host. The fetcher makes workers wait on slow or
+// rate limited hosts, so rather than in order, jobs go to the host with the fewest in-flight ones, and no host
+// gets more than its share of the workers while other hosts have work.
+type hostQueues struct {
+	workers int
+	// Hosts in the order their first job was queued, ties go to the first one
+	hosts    []string
+	jobs     map[string][]job
+	inFlight map[string]int
+	// Number of jobs queued but not handed out yet
+	queued int
+}
+
+func newHostQueues(jobs []job, workers int) *hostQueues {
+	q := &hostQueues{workers: workers, jobs: map[string][]job{}, inFlight: map[string]int{}}
+	for _, j := range jobs {
+		host := hostOf(j.url)
+		if _, ok := q.jobs[host]; !ok {
+			q.hosts = append(q.hosts, host)
+		}
+		q.jobs[host] = append(q.jobs[host], j)
+	}
+	q.queued = len(jobs)
+	return q
+}
+
+// peek returns the next job to hand out, `false` if there are none left or every host with queued jobs
+// already has its share of the workers
+func (q *hostQueues) peek() (job, bool) {
+	busy := 0
+	for _, host := range q.hosts {
+		if len(q.jobs[host]) > 0 || q.inFlight[host] > 0 {
+			busy++
+		}
+	}
+	if busy == 0 {
+		return job{}, false
+	}
+	share := (q.workers + busy - 1) / busy
+
+	next := ""
+	found := false
+	for _, host := range q.hosts {
+		if len(q.jobs[host]) > 0 && q.inFlight[host] < share && (!found || q.inFlight[host] < q.inFlight[next]) {
+			next, found = host, true
+		}
+	}
+	if !found {
+		return job{}, false
+	}
+	return q.jobs[next][0], true
+}
+
+// start takes `j`, as returned by `peek`, out of its queue once a worker got it
+func (q *hostQueues) start(j job) {
+	host := hostOf(j.url)
+	q.jobs[host] = q.jobs[host][1:]
+	q.inFlight[host]++
+	q.queued--
+}
+
+// done is called once a worker is done with `j`
+func (q *hostQueues) done(j job) {
+	q.inFlight[hostOf(j.url)]--
+}
@@ -2,9 +2,15 @@ package frontier
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/fcgravalos/wanna-crawl/crawler"
+	"github.com/fcgravalos/wanna-crawl/robots"
 	"github.com/fcgravalos/wanna-crawl/seen"
 	"github.com/fcgravalos/wanna-crawl/storage"
 	logr "github.com/sirupsen/logrus"
@@ -16,6 +22,14 @@ type Config struct {
 	MaxConcurrency   int
 	MaxDepth         int
 	PublishQueueSize int
+	// Directory where the crawl state is saved, empty disables checkpoints
+	CheckpointDir string
+	// How often the crawl state is saved
+	CheckpointInterval time.Duration
+	// Whether links to other hosts than the seed's, and links found at max depth, are checked but not crawled
+	CheckLinks bool
+	// Kinds of links crawled, the rest are only recorded. Every kind is crawled if empty
+	Follow []string
 }
 
 // Frontier will tell the crawler what to crawl next
@@ -32,12 +46,139 @@ type Frontier struct {
 	*logr.Logger
 	// Frontier configuration
 	Config
+
+	// Held for writing while a checkpoint is taken, so managers never leave a url seen but not pending
+	state sync.RWMutex
+	// Guards `pending` and `waiting`
+	mu sync.Mutex
+	// Urls already seen but not crawled yet
+	pending map[string]job
+	// Seeds whose frontier server has not started yet
+	waiting map[string]bool
+}
+
+// job is a url waiting to be crawled along with its distance, in links, from the seed
+type job struct {
+	url   string
+	depth int
+	seed  string
+	// Whether the url is only checked, wherever it is
+	check bool
+}
+
+// crawled is what a worker publishes once it is done with a job
+type crawled struct {
+	job
+	links []string
+	// Links found that must only be checked
+	checks []string
+}
+
+// newPage builds the storage record for the `j` job given the crawling `result` and `err`
+func newPage(j job, result *crawler.Result, err error) *storage.Page {
+	page := &storage.Page{URL: j.url, Depth: j.depth}
+	if result != nil && result.Response != nil {
+		page.FinalURL = result.FinalURL
+		page.Redirects = result.Redirects
+		page.StatusCode = result.StatusCode
+		page.ContentType = result.ContentType
+		page.FetchedAt = result.FetchedAt
+		page.Latency = result.Latency
+		page.Attempts = result.Attempts
+		page.Noindex = result.Noindex
+		page.Skipped = result.Skipped
+		if len(result.Body) > 0 {
+			sum := sha256.Sum256(result.Body)
+			page.ContentHash = hex.EncodeToString(sum[:])
+		}
+		if result.Links != nil {
+			page.Links = make([]storage.Link, 0, len(result.Links))
+			for _, l := range result.Links {
+				page.Links = append(page.Links, storage.Link{URL: l.URL, Text: l.Text, Kind: l.Kind, Nofollow: l.Nofollow})
+			}
+		}
+	}
+	if err != nil {
+		page.Error = err.Error()
+	}
+	return page
+}
+
+// follows returns `true` if links of `kind` must be crawled
+func (f *Frontier) follows(kind string) bool {
+	if len(f.Follow) == 0 {
+		return true
+	}
+	for _, k := range f.Follow {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOnly returns `true` if the `j` job url must only be checked, not crawled
+func (f *Frontier) checkOnly(j job) bool {
+	return f.CheckLinks && (j.check || j.depth > f.MaxDepth || !f.InScope(j.seed, j.url))
+}
+
+// crawl processes a single job and returns the links found to crawl and to only check, if any.
+// It returns `false` if the crawl was aborted, in which case the job must stay pending.
+func (f *Frontier) crawl(log *logr.Entry, j job) ([]string, []string, bool) {
+	// The job may have been upgraded to a crawl one since it was queued
+	f.mu.Lock()
+	if p, ok := f.pending[j.url]; ok {
+		j.check = p.check
+	}
+	f.mu.Unlock()
+
+	var result *crawler.Result
+	var err error
+	if f.checkOnly(j) {
+		result, err = f.Check(j.url)
+	} else {
+		result, err = f.Crawl(j.url)
+	}
+	if f.ctx.Err() != nil {
+		return nil, nil, false
+	}
+	if errors.Is(err, robots.ErrDisallowed) {
+		// Not a failure, the url is stored as skipped so it still shows up in the results
+		log.Infof("skipping %s: %v", j.url, robots.ErrDisallowed)
+		page := newPage(j, nil, nil)
+		page.Skipped = robots.ErrDisallowed.Error()
+		if err := f.Store(page); err != nil {
+			log.Errorf("failed to store %s: %v", j.url, err)
+		}
+		return nil, nil, true
+	}
+	if err := f.Store(newPage(j, result, err)); err != nil {
+		log.Errorf("failed to store %s: %v", j.url, err)
+	}
+	if err != nil {
+		log.Error(err, "failed to crawl", "url", j.url)
+		return nil, nil, true
+	}
+	links, checks := []string{}, []string{}
+	for _, l := range result.Links {
+		switch {
+		case f.follows(l.Kind) && !l.Nofollow:
+			links = append(links, l.URL)
+		case f.CheckLinks:
+			// Links not to be crawled can still be broken
+			checks = append(checks, l.URL)
+		}
+	}
+	return links, checks, true
 }
 
-func (f *Frontier) spawnCrawlingWorkers(wg *sync.WaitGroup, next chan string, publish chan []string, limits chan struct{}) {
+// spawnCrawlingWorkers starts the workers. Every job taken from `next` gets exactly one answer in `publish`,
+// even if crawling failed, so the manager can tell when a depth level is done.
+func (f *Frontier) spawnCrawlingWorkers(wg *sync.WaitGroup, next chan job, publish chan crawled, limits chan struct{}) {
 	for i := 0; i < f.MaxConcurrency; i++ {
 		wg.Add(1)
-		go func(workerId int, next chan string, publish chan []string, limits chan struct{}) {
+		go func(workerId int, next chan job, publish chan crawled, limits chan struct{}) {
+			defer wg.Done()
 			log := f.WithFields(logr.Fields{
 				"frontier_role": "worker",
 				"worker_id":     workerId,
@@ -45,21 +186,23 @@ func (f *Frontier) spawnCrawlingWorkers(wg *sync.WaitGroup, next chan string, pu
 
 			for {
 				select {
-				case l := <-next:
-					found, err := f.Crawl(l)
-					if err != nil {
-						log.Error(err, "failed to crawl", "url", l)
-						break
+				case j := <-next:
+					links, checks, ok := f.crawl(log, j)
+					if !ok {
+						log.Debug("context canceled shutting down")
+						return
+					}
+					select {
+					case publish <- crawled{j, links, checks}:
+					case <-f.ctx.Done():
+						log.Debug("context canceled shutting down")
+						return
 					}
-					f.Store(l, found)
-					publish <- found
 				case <-limits:
 					log.Debug("max depth reached, shutting down")
-					wg.Done()
 					return
 				case <-f.ctx.Done():
 					log.Debug("context canceled shutting down")
-					wg.Done()
 					return
 				}
 			}
@@ -67,16 +210,57 @@ func (f *Frontier) spawnCrawlingWorkers(wg *sync.WaitGroup, next chan string, pu
 	}
 }
 
-func (f *Frontier) run(seeds []string) {
+// unseen returns the `links` not seen before, marking them as seen.
+// Checking and marking is atomic, so frontier servers sharing the cache never crawl the same url twice.
+func (f *Frontier) unseen(log *logr.Entry, links []string) []string {
+	fresh := []string{}
+	for _, link := range links {
+		added, err := f.AddIfAbsent(link)
+		if err != nil {
+			log.Warnf("failed to add %s to seen cache, might be revisited", link)
+		}
+		if added || err != nil {
+			fresh = append(fresh, link)
+		}
+	}
+	return fresh
+}
+
+// enqueue marks the `links` found at `depth` as seen and returns the jobs for the ones not seen before,
+// which are only checked if `check` is set. Callers must hold `f.state` for reading.
+func (f *Frontier) enqueue(log *logr.Entry, links []string, depth int, seed string, check bool) []job {
+	// Seen cache lookups may be network round trips, so they are done before locking the frontier
+	fresh := f.unseen(log, links)
+
+	jobs := []job{}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, link := range fresh {
+		j := job{url: link, depth: depth, seed: seed, check: check}
+		f.pending[link] = j
+		jobs = append(jobs, j)
+	}
+	if !check {
+		// Urls queued to be checked only, because another page linked them with nofollow or as a kind not
+		// followed, are crawled after all
+		for _, link := range links {
+			if p, ok := f.pending[link]; ok && p.check {
+				p.check = false
+				f.pending[link] = p
+			}
+		}
+	}
+	return jobs
+}
+
+// run crawls breadth first from `jobs`, one depth level at a time. A level is fully crawled before
+// the next one starts, so every url is stored with its shortest distance from the seeds.
+func (f *Frontier) run(jobs []job) {
 	log := f.WithFields(logr.Fields{
 		"frontier_role": "manager",
 	})
-	next := make(chan string)
-	publish := make(chan []string, f.PublishQueueSize)
-
-	// Initialize the frontier
-	log.Info("initializing frontier with seeds")
-	go func(s []string, p chan []string) { p <- s }(seeds, publish)
+	next := make(chan job)
+	publish := make(chan crawled, f.PublishQueueSize)
 
 	// To cancel smoothly all crawling jobs when depth limit has been reached
 	limits := make(chan struct{}, 1)
@@ -84,56 +268,159 @@ func (f *Frontier) run(seeds []string) {
 	// Start workers
 	log.Infof("starting %d workers", f.MaxConcurrency)
 	var wg sync.WaitGroup
-	go f.spawnCrawlingWorkers(&wg, next, publish, limits)
-
-	// Dispatch crawling jobs; stop when limit hit
-	for depth := f.MaxDepth; depth >= 0; depth-- {
-		batch := <-publish
-		for _, link := range batch {
-			if !f.Seen(link) {
-				if err := f.Add(link); err != nil {
-					log.Warnf("failed to add %s to seen cache, might be revisited", link)
+	f.spawnCrawlingWorkers(&wg, next, publish, limits)
+
+	// Initialize the frontier, resumed crawls may start at any depth
+	log.Info("initializing frontier")
+	levels := map[int][]job{}
+	first, deepest := -1, 0
+	for _, j := range jobs {
+		levels[j.depth] = append(levels[j.depth], j)
+		if first < 0 || j.depth < first {
+			first = j.depth
+		}
+		if j.depth > deepest {
+			deepest = j.depth
+		}
+	}
+
+	// Links found at max depth are only checked when checking links
+	last := f.MaxDepth
+	if f.CheckLinks {
+		last++
+	}
+
+	// Dispatch crawling jobs level by level; links found beyond the last level are discarded
+	for depth := first; first >= 0 && depth <= last && (len(levels[depth]) > 0 || depth < deepest); depth++ {
+		log.Debugf("crawling %d urls at depth %d", len(levels[depth]), depth)
+		level := newHostQueues(levels[depth], f.MaxConcurrency)
+		pending := 0
+		for level.queued > 0 || pending > 0 {
+			// A nil channel blocks forever, so nothing is dispatched once the level is exhausted
+			var out chan job
+			j, ok := level.peek()
+			if ok {
+				out = next
+			}
+
+			select {
+			case out <- j:
+				level.start(j)
+				pending++
+			case c := <-publish:
+				level.done(c.job)
+				pending--
+				// Children become pending before the parent stops being so
+				f.state.RLock()
+				if depth < last {
+					// Links to crawl go first, so a url both crawled and checked from the same page is crawled
+					levels[depth+1] = append(levels[depth+1], f.enqueue(log, c.links, depth+1, c.seed, false)...)
+					levels[depth+1] = append(levels[depth+1], f.enqueue(log, c.checks, depth+1, c.seed, true)...)
 				}
-				next <- link
+				f.mu.Lock()
+				delete(f.pending, c.url)
+				f.mu.Unlock()
+				f.state.RUnlock()
+			case <-f.ctx.Done():
+				log.Debug("context canceled shutting down")
+				wg.Wait()
+				return
 			}
 		}
+		delete(levels, depth)
 	}
 	// Max Depth hit
 	close(limits)
 	wg.Wait()
 
+	// Urls beyond max depth of resumed crawls are never crawled
+	f.mu.Lock()
+	for _, level := range levels {
+		for _, j := range level {
+			delete(f.pending, j.url)
+		}
+	}
+	f.mu.Unlock()
+
 	// Cleanup channels
 	close(next)
 	close(publish)
 	return
 }
 
-// StartManager will start all Frontier servers ans will wait for the result
-func (f *Frontier) StartManager(seeds []string, done chan struct{}) {
+// admit returns the job for `seed`, or nothing if it has already been seen
+func (f *Frontier) admit(seed string) []job {
+	log := f.WithFields(logr.Fields{
+		"frontier_role": "manager",
+	})
+	f.state.RLock()
+	defer f.state.RUnlock()
+	jobs := f.enqueue(log, []string{seed}, 0, seed, false)
+	f.mu.Lock()
+	delete(f.waiting, seed)
+	f.mu.Unlock()
+	return jobs
+}
+
+// startManager runs a frontier server for every seed in `seeds` and for every group of `resumed` jobs
+func (f *Frontier) startManager(seeds []string, resumed map[string][]job, done chan struct{}) {
+	f.mu.Lock()
+	for _, seed := range seeds {
+		f.waiting[seed] = true
+	}
+	f.mu.Unlock()
+
+	// Resumed servers go first, in a stable order
+	resumedSeeds := []string{}
+	for seed := range resumed {
+		resumedSeeds = append(resumedSeeds, seed)
+	}
+	sort.Strings(resumedSeeds)
+
 	// Start frontier pool
 	var wg sync.WaitGroup
 	frontierPool := make(chan struct{}, f.MaxPoolSize)
-	for _, seed := range seeds {
+	start := func(seed string, jobs []job) {
 		frontierPool <- struct{}{}
 		wg.Add(1)
-		go func(f *Frontier, seed string, pool chan struct{}) {
+		go func(f *Frontier, seed string, jobs []job, pool chan struct{}) {
 			defer wg.Done()
-			f.run([]string{seed})
-			<-pool
-		}(f, seed, frontierPool)
+			defer func() { <-pool }()
+			if f.ctx.Err() != nil {
+				// Not started seeds remain waiting for a resume
+				return
+			}
+			if jobs == nil {
+				jobs = f.admit(seed)
+			}
+			f.run(jobs)
+		}(f, seed, jobs, frontierPool)
+	}
+	for _, seed := range resumedSeeds {
+		start(seed, resumed[seed])
+	}
+	for _, seed := range seeds {
+		start(seed, nil)
 	}
 	wg.Wait()
 	done <- struct{}{}
 }
 
+// StartManager will start all Frontier servers ans will wait for the result
+func (f *Frontier) StartManager(seeds []string, done chan struct{}) {
+	f.startManager(seeds, nil, done)
+}
+
 // NewFrontier will return a Frontier object
 func NewFrontier(ctx context.Context, seenCache seen.Cache, db storage.Storage, c *crawler.Crawler, l *logr.Logger, cfg Config) *Frontier {
 	return &Frontier{
-		ctx,
-		seenCache,
-		db,
-		c,
-		l,
-		cfg,
+		ctx:     ctx,
+		Cache:   seenCache,
+		Storage: db,
+		Crawler: c,
+		Logger:  l,
+		Config:  cfg,
+		pending: make(map[string]job),
+		waiting: make(map[string]bool),
 	}
 }
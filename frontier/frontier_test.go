@@ -3,10 +3,17 @@ package frontier
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
 	neturl "net/url"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fcgravalos/wanna-crawl/crawler"
+	"github.com/fcgravalos/wanna-crawl/fetcher"
+	"github.com/fcgravalos/wanna-crawl/robots"
 	"github.com/fcgravalos/wanna-crawl/seen"
 	"github.com/fcgravalos/wanna-crawl/storage"
 	logr "github.com/sirupsen/logrus"
@@ -29,51 +36,489 @@ const fakeResponse = `
 </body>
 </html>`
 
-type testFetcher struct{}
+// sha256 of `fakeResponse`
+const fakeResponseHash = "1626bf4cf5589c4ba28d2405040beaeceafb19ee223efb85c9f9281f0f9a716c"
 
-func (t *testFetcher) Fetch(url string) ([]byte, error) {
-	u, _ := neturl.Parse(url)
-	resp := []byte("")
-	if u.Path == "" || u.Path == "/" {
-		resp = []byte(fakeResponse)
+// fakeSite maps a path to the paths it links to
+var fakeSite = map[string][]string{
+	"/":       {"/a", "/b"},
+	"/a":      {"/a/1", "/shared"},
+	"/b":      {"/b/1"},
+	"/b/1":    {"/shared"},
+	"/a/1":    {"/a/1/x"},
+	"/shared": {"/shared/child"},
+	"/a/1/x":  {"/deep"},
+}
+
+// linking returns a page linking to `hrefs`
+func linking(hrefs ...string) fetcher.Response {
+	var page strings.Builder
+	for _, href := range hrefs {
+		page.WriteString(fmt.Sprintf(`<a href="%s">link</a>`, href))
 	}
-	return resp, nil
+	return fetcher.Response{Body: []byte(page.String())}
 }
 
-func TestStartManager(t *testing.T) {
-	cfg := Config{
-		MaxPoolSize:      1,
-		MaxConcurrency:   1,
-		MaxDepth:         1,
-		PublishQueueSize: 1024,
+// site returns the pages of `fakeSite` served at `root`, `/a` being much slower than the rest
+func site(root string) map[string]fetcher.Response {
+	pages := map[string]fetcher.Response{}
+	for path, links := range fakeSite {
+		pages[root+path] = linking(links...)
 	}
+	slow := pages[root+"/a"]
+	slow.Latency = 50 * time.Millisecond
+	pages[root+"/a"] = slow
+	return pages
+}
+
+// fakeFetcher serves canned `pages` by url, after waiting for their `Latency`, and an empty page for the rest.
+// It records the method every url is requested with, and how many times it is fetched with GET.
+type fakeFetcher struct {
+	pages map[string]fetcher.Response
+	// Urls failing with an error instead
+	errs map[string]error
+	// Called on every request before answering, if set
+	before func(url string)
 
-	crawlerCfg := crawler.Config{
-		FollowExternalLinks: true,
+	sync.Mutex
+	methods map[string]string
+	fetches map[string]int
+}
+
+func newFakeFetcher(pages map[string]fetcher.Response) *fakeFetcher {
+	return &fakeFetcher{pages: pages, methods: map[string]string{}, fetches: map[string]int{}}
+}
+
+func (f *fakeFetcher) request(method string, url string) (*fetcher.Response, error) {
+	f.Lock()
+	f.methods[url] = method
+	if method == http.MethodGet {
+		f.fetches[url]++
+	}
+	f.Unlock()
+	if f.before != nil {
+		f.before(url)
+	}
+	if err, ok := f.errs[url]; ok {
+		return nil, err
 	}
 
-	db, _ := storage.NewStorage("in-memory")
-	seenCache, _ := seen.NewCache("in-memory")
+	resp := f.pages[url]
+	time.Sleep(resp.Latency)
+	resp.URL = url
+	if resp.FinalURL == "" {
+		resp.FinalURL = url
+	}
+	if resp.StatusCode == 0 {
+		resp.StatusCode = http.StatusOK
+	}
+	if method == http.MethodHead {
+		resp.Body = nil
+	}
+	return &resp, nil
+}
 
-	logger := new(logr.Logger)
-	ctx := context.TODO()
+func (f *fakeFetcher) Fetch(url string) (*fetcher.Response, error) {
+	return f.request(http.MethodGet, url)
+}
 
-	c := crawler.NewCrawler(&testFetcher{}, logger, crawlerCfg)
-	f := NewFrontier(ctx, seenCache, db, c, logger, cfg)
+func (f *fakeFetcher) Head(url string) (*fetcher.Response, error) {
+	return f.request(http.MethodHead, url)
+}
 
-	done := make(chan struct{}, 1)
-	expectedSiteMap := map[string][]string{
-		"https://wanna-crawl.com/":           []string{"https://wanna-crawl.com/login", "https://wanna-crawl.com/about-us", "https://wanna-crawl.com/index.html", "https://external.com/example"},
-		"https://wanna-crawl.com/login":      []string{},
-		"https://wanna-crawl.com/about-us":   []string{},
-		"https://wanna-crawl.com/index.html": []string{},
-		"https://external.com/example":       []string{},
+// testConfig is the setup of a frontier test run
+type testConfig struct {
+	Config
+	Crawler crawler.Config
+	// Urls the crawl starts from, the home page of wanna-crawl.com if empty
+	Seeds []string
+	// Urls failing with an error instead of being served
+	Errors map[string]error
+	// Called on every request before answering, if set
+	Before func(url string)
+}
+
+// testRun is the outcome of a frontier test run
+type testRun struct {
+	db storage.Storage
+	// Stored pages by url
+	pages map[string]storage.Page
+	*fakeFetcher
+}
+
+// runFrontier crawls `pages` with a single frontier server and 2 workers, unless `cfg` says otherwise,
+// and returns once the crawl is done
+func runFrontier(t *testing.T, cfg testConfig, pages map[string]fetcher.Response) *testRun {
+	if cfg.MaxPoolSize == 0 {
+		cfg.MaxPoolSize = 1
+	}
+	if cfg.MaxConcurrency == 0 {
+		cfg.MaxConcurrency = 2
+	}
+	if cfg.PublishQueueSize == 0 {
+		cfg.PublishQueueSize = 1024
+	}
+	if len(cfg.Seeds) == 0 {
+		cfg.Seeds = []string{"https://wanna-crawl.com/"}
 	}
-	expectedJSON, _ := json.MarshalIndent(expectedSiteMap, "", "\t")
 
-	f.StartManager([]string{"https://wanna-crawl.com/"}, done)
+	db, _ := storage.NewStorage("in-memory", storage.Config{})
+	seenCache, _ := seen.NewCache("in-memory", seen.Config{})
+	logger := new(logr.Logger)
+	fake := newFakeFetcher(pages)
+	fake.errs, fake.before = cfg.Errors, cfg.Before
+	c := crawler.NewCrawler(fake, logger, cfg.Crawler)
+	f := NewFrontier(context.TODO(), seenCache, db, c, logger, cfg.Config)
 
+	done := make(chan struct{}, 1)
+	f.StartManager(cfg.Seeds, done)
 	<-done
+
 	sitemap, _ := db.Dump()
+	stored := map[string]storage.Page{}
+	assert.Nil(t, json.Unmarshal([]byte(sitemap), &stored))
+	return &testRun{db: db, pages: stored, fakeFetcher: fake}
+}
+
+// depths returns the depth every page was stored with, by path
+func depths(t *testing.T, pages map[string]storage.Page) map[string]int {
+	found := map[string]int{}
+	for u, p := range pages {
+		assert.Empty(t, p.Error, u)
+		parsed, _ := neturl.Parse(u)
+		found[parsed.Path] = p.Depth
+	}
+	return found
+}
+
+func TestStartManager(t *testing.T) {
+	run := runFrontier(t, testConfig{
+		Config:  Config{MaxConcurrency: 1, MaxDepth: 1},
+		Crawler: crawler.Config{Scope: crawler.ScopeAll},
+	}, map[string]fetcher.Response{
+		"https://wanna-crawl.com/":      {Body: []byte(fakeResponse)},
+		"https://wanna-crawl.com/login": {StatusCode: 500},
+	})
+
+	expectedSiteMap := map[string]*storage.Page{
+		"https://wanna-crawl.com/": {FinalURL: "https://wanna-crawl.com/", StatusCode: 200, ContentHash: fakeResponseHash, Links: []storage.Link{
+			{URL: "https://wanna-crawl.com/login", Text: "This is a link", Kind: "a"},
+			{URL: "https://wanna-crawl.com/about-us", Text: "This is a relative link", Kind: "a"},
+			{URL: "https://wanna-crawl.com/index.html", Text: "This is a link", Kind: "a"},
+			{URL: "https://external.com/example", Text: "External link", Kind: "a"},
+		}},
+		"https://wanna-crawl.com/login":      {Depth: 1, FinalURL: "https://wanna-crawl.com/login", StatusCode: 500, Error: "https://wanna-crawl.com/login returned status code 500"},
+		"https://wanna-crawl.com/about-us":   {Depth: 1, FinalURL: "https://wanna-crawl.com/about-us", StatusCode: 200, Links: []storage.Link{}},
+		"https://wanna-crawl.com/index.html": {Depth: 1, FinalURL: "https://wanna-crawl.com/index.html", StatusCode: 200, Links: []storage.Link{}},
+		"https://external.com/example":       {Depth: 1, FinalURL: "https://external.com/example", StatusCode: 200, Links: []storage.Link{}},
+	}
+	expectedJSON, _ := json.MarshalIndent(expectedSiteMap, "", "\t")
+
+	sitemap, _ := run.db.Dump()
 	assert.EqualValues(t, string(expectedJSON), sitemap)
 }
+
+func TestRunDepth(t *testing.T) {
+	testCases := []struct {
+		maxDepth int
+		expected map[string]int
+	}{
+		{0, map[string]int{"/": 0}},
+		{1, map[string]int{"/": 0, "/a": 1, "/b": 1}},
+		{2, map[string]int{"/": 0, "/a": 1, "/b": 1, "/a/1": 2, "/shared": 2, "/b/1": 2}},
+		// `/shared` is reached through the slow `/a` at depth 2 and through `/b/1` at depth 3
+		{3, map[string]int{"/": 0, "/a": 1, "/b": 1, "/a/1": 2, "/shared": 2, "/b/1": 2, "/a/1/x": 3, "/shared/child": 3}},
+		{10, map[string]int{"/": 0, "/a": 1, "/b": 1, "/a/1": 2, "/shared": 2, "/b/1": 2, "/a/1/x": 3, "/shared/child": 3, "/deep": 4}},
+	}
+
+	for _, tc := range testCases {
+		run := runFrontier(t, testConfig{
+			Config:  Config{MaxConcurrency: 4, MaxDepth: tc.maxDepth},
+			Crawler: crawler.Config{Scope: crawler.ScopeAll},
+		}, site("https://wanna-crawl.com"))
+
+		assert.Equal(t, tc.expected, depths(t, run.pages), "max depth %d", tc.maxDepth)
+	}
+}
+
+func TestConcurrentFrontiersNeverCrawlTwice(t *testing.T) {
+	cfg := Config{
+		MaxPoolSize:      4,
+		MaxConcurrency:   4,
+		MaxDepth:         10,
+		PublishQueueSize: 1024,
+	}
+	db, _ := storage.NewStorage("in-memory", storage.Config{})
+	seenCache, _ := seen.NewCache("in-memory", seen.Config{})
+	logger := new(logr.Logger)
+	fake := newFakeFetcher(site("https://wanna-crawl.com"))
+	c := crawler.NewCrawler(fake, logger, crawler.Config{Scope: crawler.ScopeAll})
+
+	// Every frontier starts from overlapping seeds of the same site
+	seeds := []string{"https://wanna-crawl.com/", "https://wanna-crawl.com/a", "https://wanna-crawl.com/b", "https://wanna-crawl.com/shared"}
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f := NewFrontier(context.TODO(), seenCache, db, c, logger, cfg)
+			done := make(chan struct{}, 1)
+			f.StartManager(seeds, done)
+			<-done
+		}()
+	}
+	wg.Wait()
+
+	// Every page in `fakeSite` plus the leaves `/shared/child` and `/deep`
+	assert.Len(t, fake.fetches, len(fakeSite)+2)
+	for u, n := range fake.fetches {
+		assert.Equal(t, 1, n, u)
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	pages := site("https://wanna-crawl.com")
+	pages["https://wanna-crawl.com/"] = fetcher.Response{Body: []byte(`<a href="/a">a</a><a href="/b">b</a><a href="https://external.com/gone">gone</a>`)}
+	pages["https://external.com/gone"] = fetcher.Response{StatusCode: 404}
+
+	run := runFrontier(t, testConfig{
+		Config:  Config{MaxConcurrency: 4, MaxDepth: 1, CheckLinks: true},
+		Crawler: crawler.Config{ExtractOutOfScope: true},
+	}, pages)
+
+	// External links and links found at max depth are checked, but not crawled any further
+	assert.Equal(t, map[string]string{
+		"https://wanna-crawl.com/":       "GET",
+		"https://wanna-crawl.com/a":      "GET",
+		"https://wanna-crawl.com/b":      "GET",
+		"https://external.com/gone":      "HEAD",
+		"https://wanna-crawl.com/a/1":    "HEAD",
+		"https://wanna-crawl.com/shared": "HEAD",
+		"https://wanna-crawl.com/b/1":    "HEAD",
+	}, run.methods)
+
+	broken, err := run.db.(storage.Querier).BrokenLinks()
+	assert.Nil(t, err)
+	assert.Equal(t, []storage.BrokenLink{{
+		Edge:       storage.Edge{From: "https://wanna-crawl.com/", To: "https://external.com/gone", Text: "gone"},
+		StatusCode: 404,
+		Error:      "https://external.com/gone returned status code 404",
+	}}, broken)
+}
+
+func TestCheckLinksNotFollowed(t *testing.T) {
+	run := runFrontier(t, testConfig{
+		Config:  Config{MaxConcurrency: 4, MaxDepth: 2, CheckLinks: true, Follow: []string{crawler.KindAnchor}},
+		Crawler: crawler.Config{Extract: []string{crawler.KindAnchor, crawler.KindImage}, RespectRelNofollow: true},
+	}, map[string]fetcher.Response{
+		"https://wanna-crawl.com/":            {Body: []byte(`<img src="/missing.png" alt="Missing"><a href="/private" rel="nofollow">Private</a><a href="/a">a</a>`)},
+		"https://wanna-crawl.com/missing.png": {StatusCode: 404},
+	})
+
+	// Images and nofollow links are not crawled, but still checked
+	assert.Equal(t, map[string]string{
+		"https://wanna-crawl.com/":            "GET",
+		"https://wanna-crawl.com/a":           "GET",
+		"https://wanna-crawl.com/missing.png": "HEAD",
+		"https://wanna-crawl.com/private":     "HEAD",
+	}, run.methods)
+
+	broken, err := run.db.(storage.Querier).BrokenLinks()
+	assert.Nil(t, err)
+	assert.Equal(t, []storage.BrokenLink{{
+		Edge:       storage.Edge{From: "https://wanna-crawl.com/", To: "https://wanna-crawl.com/missing.png", Text: "Missing"},
+		StatusCode: 404,
+		Error:      "https://wanna-crawl.com/missing.png returned status code 404",
+	}}, broken)
+}
+
+func TestCheckLinksCrawlsFollowedLater(t *testing.T) {
+	// `/target` is first linked with nofollow from `/a`, then with a followable link from `/b`, at the same depth
+	run := runFrontier(t, testConfig{
+		Config:  Config{MaxConcurrency: 1, MaxDepth: 3, CheckLinks: true},
+		Crawler: crawler.Config{RespectRelNofollow: true},
+	}, map[string]fetcher.Response{
+		"https://wanna-crawl.com/":       linking("/a", "/b"),
+		"https://wanna-crawl.com/a":      {Body: []byte(`<a href="/target" rel="nofollow">Target</a>`)},
+		"https://wanna-crawl.com/b":      linking("/target"),
+		"https://wanna-crawl.com/target": linking("/child"),
+	})
+
+	// A single followable link is enough to crawl it
+	assert.Equal(t, "GET", run.methods["https://wanna-crawl.com/target"])
+	assert.Equal(t, "GET", run.methods["https://wanna-crawl.com/child"])
+	assert.Equal(t, 2, run.pages["https://wanna-crawl.com/target"].Depth)
+}
+
+func TestFollowKinds(t *testing.T) {
+	// An image on every page
+	pages := site("https://wanna-crawl.com")
+	for u, p := range pages {
+		p.Body = append(p.Body, `<img src="/logo.png" alt="Logo">`...)
+		pages[u] = p
+	}
+
+	run := runFrontier(t, testConfig{
+		Config:  Config{MaxDepth: 2, Follow: []string{crawler.KindAnchor}},
+		Crawler: crawler.Config{Extract: []string{crawler.KindAnchor, crawler.KindImage}},
+	}, pages)
+
+	// Images are recorded, but not crawled
+	assert.Equal(t, []storage.Link{
+		{URL: "https://wanna-crawl.com/a", Text: "link", Kind: "a"},
+		{URL: "https://wanna-crawl.com/b", Text: "link", Kind: "a"},
+		{URL: "https://wanna-crawl.com/logo.png", Text: "Logo", Kind: "img"},
+	}, run.pages["https://wanna-crawl.com/"].Links)
+	assert.NotContains(t, run.fetches, "https://wanna-crawl.com/logo.png")
+	assert.Contains(t, run.fetches, "https://wanna-crawl.com/a/1")
+}
+
+func TestNofollow(t *testing.T) {
+	// A nofollow link on every page, and `/b` asks not to follow any of its links
+	pages := site("https://wanna-crawl.com")
+	for u, p := range pages {
+		p.Body = append(p.Body, `<a href="/private" rel="nofollow">Private</a>`...)
+		pages[u] = p
+	}
+	b := pages["https://wanna-crawl.com/b"]
+	b.Header = http.Header{"X-Robots-Tag": {"nofollow"}}
+	pages["https://wanna-crawl.com/b"] = b
+
+	run := runFrontier(t, testConfig{
+		Config:  Config{MaxDepth: 2},
+		Crawler: crawler.Config{RespectRelNofollow: true, RespectNofollow: true},
+	}, pages)
+
+	// Nofollow links are recorded, but not crawled
+	assert.Equal(t, []storage.Link{
+		{URL: "https://wanna-crawl.com/a", Text: "link", Kind: "a"},
+		{URL: "https://wanna-crawl.com/b", Text: "link", Kind: "a"},
+		{URL: "https://wanna-crawl.com/private", Text: "Private", Kind: "a", Nofollow: true},
+	}, run.pages["https://wanna-crawl.com/"].Links)
+	assert.NotContains(t, run.fetches, "https://wanna-crawl.com/private")
+	assert.NotContains(t, run.fetches, "https://wanna-crawl.com/b/1")
+	assert.Contains(t, run.fetches, "https://wanna-crawl.com/a/1")
+}
+
+func TestRedirectKeepsScope(t *testing.T) {
+	// a.example redirects to b.example
+	run := runFrontier(t, testConfig{
+		Config:  Config{MaxDepth: 2},
+		Crawler: crawler.Config{Scope: crawler.ScopeHost},
+		Seeds:   []string{"https://a.example/"},
+	}, map[string]fetcher.Response{
+		"https://a.example/": {
+			FinalURL:  "https://b.example/",
+			Redirects: []string{"https://a.example/"},
+			Body:      []byte(`<a href="/next">Next</a><a href="https://a.example/back">Back</a>`),
+		},
+	})
+
+	// Links of the redirect target are judged against the seed host, not the one it redirected to
+	assert.Equal(t, map[string]int{"https://a.example/": 1, "https://a.example/back": 1}, run.fetches)
+}
+
+func TestRobotsDisallowedAreStored(t *testing.T) {
+	run := runFrontier(t, testConfig{
+		Config: Config{MaxDepth: 2},
+		Errors: map[string]error{
+			"https://wanna-crawl.com/b": fmt.Errorf("https://wanna-crawl.com/b: %w", robots.ErrDisallowed),
+			"https://wanna-crawl.com/a": fmt.Errorf("%w: https://wanna-crawl.com/robots.txt returned status code 503", robots.ErrUnavailable),
+		},
+	}, site("https://wanna-crawl.com"))
+
+	// Disallowed urls are stored as skipped, not as failed, and their links are never found
+	assert.Equal(t, storage.Page{Depth: 1, Skipped: robots.ErrDisallowed.Error()}, run.pages["https://wanna-crawl.com/b"])
+	assert.NotContains(t, run.pages, "https://wanna-crawl.com/b/1")
+
+	// Urls whose robots.txt could not be fetched are not known to be disallowed
+	assert.Equal(t, storage.Page{Depth: 1, Error: "robots.txt unavailable: https://wanna-crawl.com/robots.txt returned status code 503"}, run.pages["https://wanna-crawl.com/a"])
+}
+
+func TestSlowHostDoesNotStallOthers(t *testing.T) {
+	// The home page links to pages of a slow host first and of a fast one next
+	home := []string{}
+	for i := 0; i < 4; i++ {
+		home = append(home, fmt.Sprintf("https://slow.example/%d", i))
+	}
+	for i := 0; i < 4; i++ {
+		home = append(home, fmt.Sprintf("https://fast.example/%d", i))
+	}
+
+	// Requests to the slow host wait for every page of the fast one, as long as a rate limited host would
+	var mu sync.Mutex
+	fastPages, stalled := 0, false
+	fast := make(chan struct{})
+	before := func(url string) {
+		switch hostOf(url) {
+		case "slow.example":
+			select {
+			case <-fast:
+			case <-time.After(time.Second):
+				mu.Lock()
+				stalled = true
+				mu.Unlock()
+			}
+		case "fast.example":
+			mu.Lock()
+			if fastPages++; fastPages == 4 {
+				close(fast)
+			}
+			mu.Unlock()
+		}
+	}
+
+	run := runFrontier(t, testConfig{
+		Config:  Config{MaxDepth: 1},
+		Crawler: crawler.Config{Scope: crawler.ScopeAll},
+		Seeds:   []string{"https://home.example/"},
+		Before:  before,
+	}, map[string]fetcher.Response{"https://home.example/": linking(home...)})
+
+	// The fast host is crawled while the slow one holds a worker
+	assert.False(t, stalled, "fast host stalled behind the slow one")
+	assert.Len(t, run.pages, 9)
+}
+
+// slowCache is a seen cache whose lookups wait for `release`, as network round trips would
+type slowCache struct {
+	seen.Cache
+	looking chan struct{}
+	release chan struct{}
+}
+
+func (s *slowCache) AddIfAbsent(url string) (bool, error) {
+	s.looking <- struct{}{}
+	<-s.release
+	return s.Cache.AddIfAbsent(url)
+}
+
+func TestEnqueueDoesNotLockDuringLookups(t *testing.T) {
+	inMemory, _ := seen.NewCache("in-memory", seen.Config{})
+	cache := &slowCache{Cache: inMemory, looking: make(chan struct{}), release: make(chan struct{})}
+	logger := new(logr.Logger)
+	f := NewFrontier(context.TODO(), cache, nil, nil, logger, Config{})
+
+	enqueued := make(chan []job)
+	go func() {
+		enqueued <- f.enqueue(logger.WithFields(logr.Fields{}), []string{"https://wanna-crawl.com/a"}, 1, "https://wanna-crawl.com/", false)
+	}()
+	<-cache.looking
+
+	// Workers can still get through while the lookup is on its way
+	locked := make(chan struct{})
+	go func() {
+		f.mu.Lock()
+		f.mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Error("frontier locked during seen cache lookups")
+	}
+	close(cache.release)
+
+	jobs := <-enqueued
+	assert.Equal(t, []job{{url: "https://wanna-crawl.com/a", depth: 1, seed: "https://wanna-crawl.com/"}}, jobs)
+}
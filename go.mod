@@ -3,9 +3,13 @@ module github.com/fcgravalos/wanna-crawl
 go 1.13
 
 require (
+	github.com/alicebob/miniredis/v2 v2.11.4
 	github.com/go-logr/logr v0.1.0
+	github.com/gomodule/redigo v1.7.1-0.20190322064113-39e2c31b7ca3
 	github.com/gorilla/mux v1.7.3
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/sirupsen/logrus v1.4.2
 	github.com/stretchr/testify v1.4.0
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/net v0.0.0-20190926025831-c00fd9afed17
 )
@@ -0,0 +1,152 @@
+package robots
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	logr "github.com/sirupsen/logrus"
+)
+
+// Checker tells whether a url can be fetched according to its host robots.txt
+type Checker interface {
+	Allowed(u string) (bool, error)
+	CrawlDelay(u string) (time.Duration, error)
+}
+
+// How long a robots.txt that could not be fetched makes its host unavailable before trying again. Long enough
+// for the requests sent to the host at once to share the failure, short enough for retries to ask again.
+const failureTTL = time.Second
+
+// entry holds the robots.txt of a single host. `ready` is closed once it has been fetched,
+// so concurrent lookups for the same host only trigger one request.
+type entry struct {
+	ready  chan struct{}
+	robots *Robots
+	// Why robots.txt could not be fetched, if it could not
+	err error
+	// When a failed fetch must be tried again, zero for the ones that did not fail
+	expires time.Time
+}
+
+// expired returns `true` if `e` has been fetched and must be fetched again
+func (e *entry) expired() bool {
+	select {
+	case <-e.ready:
+		return !e.expires.IsZero() && time.Now().After(e.expires)
+	default:
+		return false
+	}
+}
+
+type httpChecker struct {
+	ctx context.Context
+	*logr.Logger
+	*http.Client
+	userAgent string
+	// How long failures to fetch robots.txt are cached
+	failureTTL time.Duration
+
+	sync.Mutex
+	hosts map[string]*entry
+}
+
+// fetch downloads and parses robots.txt for the `scheme://host` given in `root`.
+// 4xx responses mean there are no restrictions; 5xx and network errors return an `ErrUnavailable` error,
+// since they might be gone in a while.
+func (c *httpChecker) fetch(root string) (*Robots, error) {
+	req, err := http.NewRequestWithContext(c.ctx, "GET", root+"/robots.txt", nil)
+	if err != nil {
+		c.Debugf("failed to build robots.txt request: %v", err)
+		return DisallowAll(), nil
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.Do(req)
+	if err != nil {
+		c.Warnf("failed to fetch %s/robots.txt, host unavailable for %v: %v", root, c.failureTTL, err)
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		robots, err := Parse(resp.Body)
+		if err != nil {
+			c.Warnf("failed to parse %s/robots.txt, disallowing host: %v", root, err)
+			return DisallowAll(), nil
+		}
+		return robots, nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return AllowAll(), nil
+	default:
+		c.Warnf("got status %d fetching %s/robots.txt, host unavailable for %v", resp.StatusCode, root, c.failureTTL)
+		return nil, fmt.Errorf("%w: %s/robots.txt returned status code %d", ErrUnavailable, root, resp.StatusCode)
+	}
+}
+
+// get returns the cached robots.txt for `u` host, fetching it if needed. Failed fetches are tried again
+// once `failureTTL` has passed.
+func (c *httpChecker) get(u *neturl.URL) (*Robots, error) {
+	root := u.Scheme + "://" + u.Host
+
+	c.Lock()
+	e, ok := c.hosts[root]
+	if !ok || e.expired() {
+		ok = false
+		e = &entry{ready: make(chan struct{})}
+		c.hosts[root] = e
+	}
+	c.Unlock()
+
+	if !ok {
+		e.robots, e.err = c.fetch(root)
+		if e.err != nil {
+			e.expires = time.Now().Add(c.failureTTL)
+		}
+		close(e.ready)
+	}
+	<-e.ready
+	return e.robots, e.err
+}
+
+// Allowed returns `true` if the configured user-agent can fetch `u`
+func (c *httpChecker) Allowed(u string) (bool, error) {
+	parsed, err := neturl.Parse(u)
+	if err != nil {
+		return false, err
+	}
+	robots, err := c.get(parsed)
+	if err != nil {
+		return false, err
+	}
+	return robots.Allowed(c.userAgent, parsed.RequestURI()), nil
+}
+
+// CrawlDelay returns the `Crawl-delay` set for the configured user-agent on `u` host
+func (c *httpChecker) CrawlDelay(u string) (time.Duration, error) {
+	parsed, err := neturl.Parse(u)
+	if err != nil {
+		return 0, err
+	}
+	robots, err := c.get(parsed)
+	if err != nil {
+		return 0, err
+	}
+	return robots.CrawlDelay(c.userAgent), nil
+}
+
+// NewChecker returns a `Checker` that fetches robots.txt files with `client`, identifying itself as `userAgent`
+func NewChecker(ctx context.Context, logger *logr.Logger, client *http.Client, userAgent string) Checker {
+	return &httpChecker{
+		ctx:        ctx,
+		Logger:     logger,
+		Client:     client,
+		userAgent:  userAgent,
+		failureTTL: failureTTL,
+		hosts:      make(map[string]*entry),
+	}
+}
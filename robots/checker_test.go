@@ -0,0 +1,98 @@
+package robots
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	logr "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckerAllowed(t *testing.T) {
+	var hits int32
+	r := mux.NewRouter()
+	r.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte(fakeRobots))
+	})
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	c := NewChecker(context.Background(), new(logr.Logger), &http.Client{Timeout: 1 * time.Second}, "some-bot")
+
+	allowed, err := c.Allowed(server.URL + "/")
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+
+	allowed, err = c.Allowed(server.URL + "/private/data")
+	assert.Nil(t, err)
+	assert.False(t, allowed)
+
+	// robots.txt is cached per host
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestCheckerStatusCodes(t *testing.T) {
+	testCases := []struct {
+		status      int
+		expected    bool
+		unavailable bool
+	}{
+		{http.StatusNotFound, true, false},
+		{http.StatusForbidden, true, false},
+		{http.StatusInternalServerError, false, true},
+		{http.StatusServiceUnavailable, false, true},
+	}
+	for _, tc := range testCases {
+		status := tc.status
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		c := NewChecker(context.Background(), new(logr.Logger), &http.Client{Timeout: 1 * time.Second}, "some-bot")
+
+		allowed, err := c.Allowed(server.URL + "/page")
+		assert.Equal(t, tc.unavailable, errors.Is(err, ErrUnavailable), "status %d", status)
+		assert.Equal(t, tc.expected, allowed, "status %d", status)
+		server.Close()
+	}
+}
+
+func TestCheckerRetriesFailures(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(fakeRobots))
+	}))
+	defer server.Close()
+
+	c := NewChecker(context.Background(), new(logr.Logger), &http.Client{Timeout: 1 * time.Second}, "some-bot")
+	c.(*httpChecker).failureTTL = 10 * time.Millisecond
+
+	_, err := c.Allowed(server.URL + "/")
+	assert.True(t, errors.Is(err, ErrUnavailable))
+
+	// Failures are cached for a while only
+	_, err = c.Allowed(server.URL + "/")
+	assert.True(t, errors.Is(err, ErrUnavailable))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	time.Sleep(20 * time.Millisecond)
+	allowed, err := c.Allowed(server.URL + "/")
+	assert.Nil(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+
+	// Successful fetches are cached for good
+	allowed, _ = c.Allowed(server.URL + "/")
+	assert.True(t, allowed)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
@@ -0,0 +1,213 @@
+package robots
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrDisallowed is returned when a url can not be fetched because robots.txt forbids it
+var ErrDisallowed = errors.New("disallowed by robots.txt")
+
+// ErrUnavailable is returned when a url can not be checked because its host robots.txt could not be fetched.
+// Unlike `ErrDisallowed`, it might be gone in a while.
+var ErrUnavailable = errors.New("robots.txt unavailable")
+
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+type group struct {
+	agents     []string
+	rules      []rule
+	crawlDelay time.Duration
+}
+
+// Robots holds the rules parsed from a robots.txt file
+type Robots struct {
+	groups []*group
+	// Urls of the `Sitemap:` lines, which apply to every user-agent
+	sitemaps []string
+}
+
+// AllowAll returns a `Robots` object with no rules, so every path is allowed
+func AllowAll() *Robots {
+	return &Robots{}
+}
+
+// DisallowAll returns a `Robots` object that forbids every path to every user-agent
+func DisallowAll() *Robots {
+	return &Robots{
+		groups: []*group{
+			{agents: []string{"*"}, rules: []rule{{allow: false, pattern: "/"}}},
+		},
+	}
+}
+
+// Parse reads a robots.txt file from `r`. Unknown or malformed lines are ignored.
+func Parse(r io.Reader) (*Robots, error) {
+	robots := &Robots{}
+	var current *group
+	// Consecutive user-agent lines belong to the same group
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		sep := strings.Index(line, ":")
+		if sep < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:sep]))
+		value := strings.TrimSpace(line[sep+1:])
+
+		switch key {
+		case "user-agent":
+			if !lastWasAgent {
+				current = &group{}
+				robots.groups = append(robots.groups, current)
+			}
+			current.agents = append(current.agents, strings.ToLower(value))
+			lastWasAgent = true
+		case "allow", "disallow":
+			lastWasAgent = false
+			if current == nil {
+				continue
+			}
+			if value == "" {
+				// An empty disallow means everything is allowed
+				continue
+			}
+			current.rules = append(current.rules, rule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			lastWasAgent = false
+			if current == nil {
+				continue
+			}
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			current.crawlDelay = time.Duration(seconds * float64(time.Second))
+		case "sitemap":
+			lastWasAgent = false
+			if value != "" {
+				robots.sitemaps = append(robots.sitemaps, value)
+			}
+		default:
+			lastWasAgent = false
+		}
+	}
+	return robots, scanner.Err()
+}
+
+// Sitemaps returns the urls of the sitemaps listed in robots.txt, in order
+func (r *Robots) Sitemaps() []string {
+	return r.sitemaps
+}
+
+// groupsFor returns the groups that best match `userAgent`.
+// The most specific user-agent wins, falling back to `*` when nothing else matches.
+func (r *Robots) groupsFor(userAgent string) []*group {
+	ua := strings.ToLower(userAgent)
+	var groups, wildcard []*group
+	best := 0
+
+	for _, g := range r.groups {
+		for _, agent := range g.agents {
+			switch {
+			case agent == "*":
+				wildcard = append(wildcard, g)
+			case strings.Contains(ua, agent):
+				if len(agent) > best {
+					best = len(agent)
+					groups = nil
+				}
+				if len(agent) == best {
+					groups = append(groups, g)
+				}
+			}
+		}
+	}
+	if best == 0 {
+		return wildcard
+	}
+	return groups
+}
+
+// CrawlDelay returns the `Crawl-delay` that applies to `userAgent`, or 0 if none is set
+func (r *Robots) CrawlDelay(userAgent string) time.Duration {
+	var delay time.Duration
+	for _, g := range r.groupsFor(userAgent) {
+		if g.crawlDelay > delay {
+			delay = g.crawlDelay
+		}
+	}
+	return delay
+}
+
+// Allowed returns `true` if `userAgent` is allowed to fetch `path`.
+// `path` must include the query string if the url has one.
+// The longest matching rule wins, and `allow` wins over `disallow` on ties.
+func (r *Robots) Allowed(userAgent string, path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+
+	allowed := true
+	longest := -1
+	for _, g := range r.groupsFor(userAgent) {
+		for _, rl := range g.rules {
+			if !match(rl.pattern, path) {
+				continue
+			}
+			if len(rl.pattern) > longest || (len(rl.pattern) == longest && rl.allow) {
+				longest = len(rl.pattern)
+				allowed = rl.allow
+			}
+		}
+	}
+	return allowed
+}
+
+// match reports whether `path` matches the robots.txt `pattern`.
+// `*` matches any sequence of characters and a trailing `$` anchors the pattern to the end of the path.
+func match(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = strings.TrimSuffix(pattern, "$")
+	}
+	parts := strings.Split(pattern, "*")
+
+	// The first part must be a prefix, since rules always match from the start of the path
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || rest == ""
+	}
+
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return strings.HasSuffix(rest, part)
+		}
+		idx := strings.Index(rest, part)
+		if idx < 0 {
+			return false
+		}
+		rest = rest[idx+len(part):]
+	}
+	return true
+}
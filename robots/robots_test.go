@@ -0,0 +1,107 @@
+package robots
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const fakeRobots = `
+# Comments are ignored
+User-agent: *
+Disallow: /private/
+Disallow: /*.pdf$
+Allow: /private/public-*
+Disallow: /search?
+
+User-agent: wanna-crawl
+User-agent: other-bot
+Disallow: /
+Allow: /docs/
+
+User-agent: greedy-bot
+Disallow:
+
+Sitemap: https://example.com/sitemap.xml
+sitemap:https://example.com/news-sitemap.xml.gz
+`
+
+func TestParse(t *testing.T) {
+	r, err := Parse(strings.NewReader(fakeRobots))
+	assert.Nil(t, err)
+	assert.Len(t, r.groups, 3)
+	assert.Equal(t, []string{"wanna-crawl", "other-bot"}, r.groups[1].agents)
+	assert.Empty(t, r.groups[2].rules)
+	assert.Equal(t, []string{"https://example.com/sitemap.xml", "https://example.com/news-sitemap.xml.gz"}, r.Sitemaps())
+	assert.Empty(t, AllowAll().Sitemaps())
+}
+
+func TestAllowed(t *testing.T) {
+	r, _ := Parse(strings.NewReader(fakeRobots))
+
+	testCases := []struct {
+		userAgent string
+		path      string
+		expected  bool
+	}{
+		{"some-bot", "/", true},
+		{"some-bot", "/private/", false},
+		{"some-bot", "/private/data", false},
+		{"some-bot", "/private/public-report", true},
+		{"some-bot", "/files/report.pdf", false},
+		{"some-bot", "/files/report.pdf?download=1", true},
+		{"some-bot", "/search?q=crawl", false},
+		{"some-bot", "/search", true},
+		{"wanna-crawl/0.0.1", "/", false},
+		{"Wanna-Crawl", "/about-us", false},
+		{"wanna-crawl", "/docs/index.html", true},
+		{"wanna-crawl", "/robots.txt", true},
+		{"greedy-bot", "/private/", true},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, r.Allowed(tc.userAgent, tc.path), "%s %s", tc.userAgent, tc.path)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	testCases := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{"/", "/anything", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish.asp", false},
+		{"/fish*", "/fishheads/yummy.html", true},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php$", "/filename.php", true},
+		{"/*.php$", "/filename.php?parameters", false},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/fish*.php", "/Fish.PHP", false},
+		{"/a$", "/a", true},
+		{"/a$", "/ab", false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, match(tc.pattern, tc.path), "%s %s", tc.pattern, tc.path)
+	}
+}
+
+func TestCrawlDelay(t *testing.T) {
+	r, _ := Parse(strings.NewReader(`
+User-agent: *
+Crawl-delay: 1.5
+
+User-agent: wanna-crawl
+Disallow: /private/
+Crawl-delay: 10
+
+User-agent: other-bot
+Crawl-delay: nonsense
+`))
+	assert.Equal(t, 1500*time.Millisecond, r.CrawlDelay("some-bot"))
+	assert.Equal(t, 10*time.Second, r.CrawlDelay("wanna-crawl"))
+	assert.Equal(t, time.Duration(0), r.CrawlDelay("other-bot"))
+	assert.Equal(t, time.Duration(0), AllowAll().CrawlDelay("wanna-crawl"))
+}
@@ -0,0 +1,223 @@
+package seeds
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	neturl "net/url"
+	"strings"
+
+	"github.com/fcgravalos/wanna-crawl/fetcher"
+	"github.com/fcgravalos/wanna-crawl/robots"
+	logr "github.com/sirupsen/logrus"
+)
+
+// Config represents sitemap seeding configuration
+type Config struct {
+	// Whether to read the sitemaps listed in the robots.txt of every root host
+	Robots bool
+	// Sitemaps, or sitemap indexes, to read
+	Sitemaps []string
+	// Max number of urls discovered, 0 means unlimited
+	MaxURLs int
+}
+
+// Discoverer finds seed urls
+type Discoverer interface {
+	// Discover returns the urls listed in the configured sitemaps and in those of the `roots` hosts, in the order
+	// they were found. Sitemaps that can not be read are skipped.
+	Discover(roots []string) ([]string, error)
+}
+
+type sitemapDiscoverer struct {
+	ctx context.Context
+	fetcher.Fetcher
+	*logr.Logger
+	Config
+}
+
+// Max size of an uncompressed sitemap, as set by the sitemaps protocol
+const maxSitemapSize = 50 * 1024 * 1024
+
+// gzipped returns `true` if `body` starts with the gzip magic number
+func gzipped(body []byte) bool {
+	return len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b
+}
+
+// parseSitemap returns the page urls of a sitemap, or the sitemap urls of a sitemap index.
+// Both the XML and the plain text, one url per line, formats are supported, gzipped or not.
+func parseSitemap(body []byte) ([]string, []string, error) {
+	if gzipped(body) {
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		// A small gzip can expand into a huge sitemap, stop reading right after the limit
+		body, err = ioutil.ReadAll(io.LimitReader(gz, maxSitemapSize+1))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(body) > maxSitemapSize {
+			return nil, nil, fmt.Errorf("uncompressed sitemap exceeds the max size of %d bytes", maxSitemapSize)
+		}
+	}
+
+	urls, sitemaps := []string{}, []string{}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] != '<' {
+		for _, line := range strings.Split(string(trimmed), "\n") {
+			if u := strings.TrimSpace(line); u != "" {
+				urls = append(urls, u)
+			}
+		}
+		return urls, sitemaps, nil
+	}
+
+	// Element names are matched without their namespace, `<loc>` belongs to the `<url>` or `<sitemap>` around it
+	stack := []string{}
+	var loc strings.Builder
+	d := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			return urls, sitemaps, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name.Local)
+			loc.Reset()
+		case xml.CharData:
+			if len(stack) > 0 && stack[len(stack)-1] == "loc" {
+				loc.Write(t)
+			}
+		case xml.EndElement:
+			if len(stack) >= 2 && t.Name.Local == "loc" {
+				u := strings.TrimSpace(loc.String())
+				switch {
+				case u == "":
+				case stack[len(stack)-2] == "url":
+					urls = append(urls, u)
+				case stack[len(stack)-2] == "sitemap":
+					sitemaps = append(sitemaps, u)
+				}
+			}
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
+
+// fetch returns the body of `u`, or an error if it could not be fetched successfully. Sitemaps and robots.txt files
+// are not web pages, so they are downloaded whatever their content type when the fetcher can
+func (s *sitemapDiscoverer) fetch(u string) ([]byte, error) {
+	fetch := s.Fetch
+	if d, ok := s.Fetcher.(fetcher.Downloader); ok {
+		fetch = d.Download
+	}
+	resp, err := fetch(u)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.OK() {
+		return nil, fmt.Errorf("%s returned status code %d", u, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// robotsSitemaps returns the sitemaps listed in the robots.txt of every `roots` host
+func (s *sitemapDiscoverer) robotsSitemaps(roots []string) []string {
+	sitemaps := []string{}
+	hosts := map[string]bool{}
+	for _, root := range roots {
+		u, err := neturl.Parse(root)
+		if err != nil || u.Host == "" {
+			s.Warnf("malformed root url %s", root)
+			continue
+		}
+		host := u.Scheme + "://" + u.Host
+		if hosts[host] {
+			continue
+		}
+		hosts[host] = true
+
+		body, err := s.fetch(host + "/robots.txt")
+		if err != nil {
+			s.Warnf("failed to read sitemaps from %s/robots.txt: %v", host, err)
+			continue
+		}
+		r, err := robots.Parse(bytes.NewReader(body))
+		if err != nil {
+			s.Warnf("failed to parse %s/robots.txt: %v", host, err)
+			continue
+		}
+		sitemaps = append(sitemaps, r.Sitemaps()...)
+	}
+	return sitemaps
+}
+
+func (s *sitemapDiscoverer) Discover(roots []string) ([]string, error) {
+	queue := append([]string{}, s.Sitemaps...)
+	if s.Robots {
+		queue = append(queue, s.robotsSitemaps(roots)...)
+	}
+
+	found := []string{}
+	seen := map[string]bool{}
+	// Sitemap indexes may list each other, every sitemap is read once
+	read := map[string]bool{}
+	for len(queue) > 0 {
+		if err := s.ctx.Err(); err != nil {
+			return found, err
+		}
+		sitemap := queue[0]
+		queue = queue[1:]
+		if read[sitemap] {
+			continue
+		}
+		read[sitemap] = true
+
+		body, err := s.fetch(sitemap)
+		if err != nil {
+			s.Warnf("failed to read sitemap %s: %v", sitemap, err)
+			continue
+		}
+		urls, nested, err := parseSitemap(body)
+		if err != nil {
+			s.Warnf("failed to parse sitemap %s: %v", sitemap, err)
+			continue
+		}
+		s.Debugf("found %d urls and %d sitemaps in %s", len(urls), len(nested), sitemap)
+		queue = append(queue, nested...)
+
+		for _, u := range urls {
+			if seen[u] || !(strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")) {
+				continue
+			}
+			if s.MaxURLs > 0 && len(found) == s.MaxURLs {
+				s.Warnf("stopped reading sitemaps after %d urls", s.MaxURLs)
+				return found, nil
+			}
+			seen[u] = true
+			found = append(found, u)
+		}
+	}
+	return found, nil
+}
+
+// NewSitemapDiscoverer returns a `Discoverer` that reads sitemaps with `f`
+func NewSitemapDiscoverer(ctx context.Context, f fetcher.Fetcher, l *logr.Logger, cfg Config) Discoverer {
+	return &sitemapDiscoverer{
+		ctx,
+		f,
+		l,
+		cfg,
+	}
+}
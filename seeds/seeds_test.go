@@ -0,0 +1,185 @@
+package seeds
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fcgravalos/wanna-crawl/fetcher"
+	logr "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+const urlset = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:image="http://www.google.com/schemas/sitemap-image/1.1">
+  <url>
+    <loc> https://example.com/ </loc>
+    <lastmod>2019-10-01</lastmod>
+  </url>
+  <url>
+    <loc>https://example.com/a?x=1&amp;y=2</loc>
+    <image:image><image:loc>https://example.com/logo.png</image:loc></image:image>
+  </url>
+  <url><loc></loc></url>
+</urlset>`
+
+const sitemapIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://example.com/sitemap-1.xml</loc><lastmod>2019-10-01</lastmod></sitemap>
+  <sitemap><loc>https://example.com/sitemap-2.xml.gz</loc></sitemap>
+</sitemapindex>`
+
+func gzipBytes(t *testing.T, s string) []byte {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	_, err := gz.Write([]byte(s))
+	assert.Nil(t, err)
+	assert.Nil(t, gz.Close())
+	return b.Bytes()
+}
+
+func TestParseSitemap(t *testing.T) {
+	testCases := []struct {
+		name     string
+		body     []byte
+		urls     []string
+		sitemaps []string
+	}{
+		{"urlset", []byte(urlset), []string{"https://example.com/", "https://example.com/a?x=1&y=2"}, []string{}},
+		{"index", []byte(sitemapIndex), []string{}, []string{"https://example.com/sitemap-1.xml", "https://example.com/sitemap-2.xml.gz"}},
+		{"gzipped", gzipBytes(t, urlset), []string{"https://example.com/", "https://example.com/a?x=1&y=2"}, []string{}},
+		{"text", []byte("https://example.com/\n\n  https://example.com/b\r\n"), []string{"https://example.com/", "https://example.com/b"}, []string{}},
+		{"empty", []byte(""), []string{}, []string{}},
+	}
+
+	for _, tc := range testCases {
+		urls, sitemaps, err := parseSitemap(tc.body)
+		assert.Nil(t, err, tc.name)
+		assert.Equal(t, tc.urls, urls, tc.name)
+		assert.Equal(t, tc.sitemaps, sitemaps, tc.name)
+	}
+
+	_, _, err := parseSitemap([]byte(`<urlset><url><loc>https://example.com/</url></urlset>`))
+	assert.Error(t, err)
+	_, _, err = parseSitemap([]byte{0x1f, 0x8b, 0x00})
+	assert.Error(t, err)
+
+	// Gzipped sitemaps are not decompressed beyond the max size
+	_, _, err = parseSitemap(gzipBytes(t, strings.Repeat(" ", maxSitemapSize+1)))
+	assert.EqualError(t, err, fmt.Sprintf("uncompressed sitemap exceeds the max size of %d bytes", maxSitemapSize))
+	_, _, err = parseSitemap(gzipBytes(t, strings.Repeat(" ", maxSitemapSize)))
+	assert.Nil(t, err)
+}
+
+// siteFetcher serves `files` by url, and 404 for the rest
+type siteFetcher struct {
+	sync.Mutex
+	files   map[string][]byte
+	fetches []string
+}
+
+func (s *siteFetcher) Fetch(url string) (*fetcher.Response, error) {
+	s.Lock()
+	s.fetches = append(s.fetches, url)
+	s.Unlock()
+	if url == "https://down.com/sitemap.xml" {
+		return nil, fmt.Errorf("connection refused")
+	}
+	body, ok := s.files[url]
+	if !ok {
+		return &fetcher.Response{URL: url, FinalURL: url, StatusCode: 404}, nil
+	}
+	return &fetcher.Response{URL: url, FinalURL: url, StatusCode: 200, Body: body}, nil
+}
+
+func (s *siteFetcher) Head(url string) (*fetcher.Response, error) {
+	return s.Fetch(url)
+}
+
+func testSite(t *testing.T) *siteFetcher {
+	return &siteFetcher{files: map[string][]byte{
+		"https://example.com/robots.txt":  []byte("User-agent: *\nDisallow: /private/\nSitemap: https://example.com/sitemap.xml\nSitemap: https://down.com/sitemap.xml\n"),
+		"https://example.com/sitemap.xml": []byte(sitemapIndex),
+		"https://example.com/sitemap-1.xml": []byte(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>https://example.com/</loc></url><url><loc>https://example.com/a</loc></url><url><loc>ftp://example.com/file</loc></url>
+</urlset>`),
+		// Indexes listing each other are read once
+		"https://example.com/sitemap-2.xml.gz": gzipBytes(t, `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>https://example.com/sitemap.xml</loc></sitemap><sitemap><loc>https://example.com/sitemap-3.txt</loc></sitemap>
+</sitemapindex>`),
+		"https://example.com/sitemap-3.txt": []byte("https://example.com/a\nhttps://example.com/b\n"),
+		"https://blog.com/robots.txt":       []byte("User-agent: *\nDisallow:\n"),
+	}}
+}
+
+func TestDiscover(t *testing.T) {
+	site := testSite(t)
+	d := NewSitemapDiscoverer(context.TODO(), site, new(logr.Logger), Config{Robots: true})
+	urls, err := d.Discover([]string{"https://example.com/", "https://example.com/about", "https://blog.com/", "https://missing.com/"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://example.com/", "https://example.com/a", "https://example.com/b"}, urls)
+	assert.Equal(t, []string{
+		"https://example.com/robots.txt",
+		"https://blog.com/robots.txt",
+		"https://missing.com/robots.txt",
+		"https://example.com/sitemap.xml",
+		"https://down.com/sitemap.xml",
+		"https://example.com/sitemap-1.xml",
+		"https://example.com/sitemap-2.xml.gz",
+		"https://example.com/sitemap-3.txt",
+	}, site.fetches)
+}
+
+func TestDiscoverSitemaps(t *testing.T) {
+	// Only the given sitemaps are read without robots
+	site := testSite(t)
+	d := NewSitemapDiscoverer(context.TODO(), site, new(logr.Logger), Config{Sitemaps: []string{"https://example.com/sitemap-3.txt"}})
+	urls, err := d.Discover([]string{"https://example.com/"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://example.com/a", "https://example.com/b"}, urls)
+	assert.Equal(t, []string{"https://example.com/sitemap-3.txt"}, site.fetches)
+}
+
+// typedSite is a `siteFetcher` whose `Fetch` skips bodies, like a fetcher only allowing HTML would
+type typedSite struct {
+	*siteFetcher
+}
+
+func (s typedSite) Fetch(url string) (*fetcher.Response, error) {
+	resp, err := s.siteFetcher.Fetch(url)
+	if resp != nil && resp.Body != nil {
+		resp.Body, resp.Skipped = nil, "content type text/xml is not allowed"
+	}
+	return resp, err
+}
+
+func (s typedSite) Download(url string) (*fetcher.Response, error) {
+	return s.siteFetcher.Fetch(url)
+}
+
+func TestDiscoverDownloads(t *testing.T) {
+	d := NewSitemapDiscoverer(context.TODO(), typedSite{testSite(t)}, new(logr.Logger), Config{Sitemaps: []string{"https://example.com/sitemap-3.txt"}})
+	urls, err := d.Discover(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://example.com/a", "https://example.com/b"}, urls)
+}
+
+func TestDiscoverMaxURLs(t *testing.T) {
+	d := NewSitemapDiscoverer(context.TODO(), testSite(t), new(logr.Logger), Config{Sitemaps: []string{"https://example.com/sitemap.xml"}, MaxURLs: 2})
+	urls, err := d.Discover(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"https://example.com/", "https://example.com/a"}, urls)
+}
+
+func TestDiscoverCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d := NewSitemapDiscoverer(ctx, testSite(t), new(logr.Logger), Config{Sitemaps: []string{"https://example.com/sitemap.xml"}})
+	urls, err := d.Discover(nil)
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, urls)
+}
@@ -0,0 +1,146 @@
+package seen
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// bloom is a seen cache backed by a bloom filter. It uses a fixed amount of memory, sized from
+// the expected number of urls and the accepted false positive rate, at the cost of reporting
+// some never seen urls as seen.
+type bloom struct {
+	sync.RWMutex
+	bits []uint64
+	// Number of bits in the filter
+	m uint64
+	// Number of hash functions
+	k uint64
+	// Number of urls that set at least one new bit, a close estimate of the distinct urls added
+	items uint64
+}
+
+func newBloom(expectedItems uint64, falsePositiveRate float64) (*bloom, error) {
+	if expectedItems == 0 {
+		return nil, errors.New("bloom filter expected items must be greater than 0")
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		return nil, errors.New("bloom filter false positive rate must be between 0 and 1")
+	}
+
+	n := float64(expectedItems)
+	m := uint64(math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Max(1, math.Round(float64(m)/n*math.Ln2)))
+	return &bloom{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}, nil
+}
+
+// locations returns the `k` bits `url` maps to, using double hashing over two FNV hashes
+func (b *bloom) locations(url string) []uint64 {
+	h1 := fnv.New64a()
+	h1.Write([]byte(url))
+	h2 := fnv.New64()
+	h2.Write([]byte(url))
+	a, c := h1.Sum64(), h2.Sum64()|1
+
+	locs := make([]uint64, b.k)
+	for i := uint64(0); i < b.k; i++ {
+		locs[i] = (a + i*c) % b.m
+	}
+	return locs
+}
+
+// Seen returns `true` if `url` is probably in the filter, `false` if it was never added.
+func (b *bloom) Seen(url string) bool {
+	locs := b.locations(url)
+	b.RLock()
+	defer b.RUnlock()
+	for _, l := range locs {
+		if b.bits[l/64]&(1<<(l%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Add will insert a new `url` in the filter
+func (b *bloom) Add(url string) error {
+	_, err := b.AddIfAbsent(url)
+	return err
+}
+
+// AddIfAbsent inserts `url` in the filter, returning `false` if it was probably there already
+func (b *bloom) AddIfAbsent(url string) (bool, error) {
+	locs := b.locations(url)
+	b.Lock()
+	defer b.Unlock()
+	added := false
+	for _, l := range locs {
+		mask := uint64(1) << (l % 64)
+		if b.bits[l/64]&mask == 0 {
+			b.bits[l/64] |= mask
+			added = true
+		}
+	}
+	if added {
+		b.items++
+	}
+	return added, nil
+}
+
+// Stats returns the filter fill ratio and its false positive rate as of now
+func (b *bloom) Stats() Stats {
+	b.RLock()
+	defer b.RUnlock()
+	set := 0
+	for _, w := range b.bits {
+		set += bits.OnesCount64(w)
+	}
+	fill := float64(set) / float64(b.m)
+	return Stats{
+		Items:             b.items,
+		FillRatio:         fill,
+		FalsePositiveRate: math.Pow(fill, float64(b.k)),
+	}
+}
+
+// Save writes the filter parameters and its bits to `w`
+func (b *bloom) Save(w io.Writer) error {
+	b.RLock()
+	defer b.RUnlock()
+	for _, v := range []uint64{b.m, b.k, b.items} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return binary.Write(w, binary.LittleEndian, b.bits)
+}
+
+// Load replaces the filter with the one saved by `Save`
+func (b *bloom) Load(r io.Reader) error {
+	var m, k, items uint64
+	for _, v := range []*uint64{&m, &k, &items} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	if m == 0 || k == 0 {
+		return errors.New("malformed bloom filter")
+	}
+	bits := make([]uint64, (m+63)/64)
+	if err := binary.Read(r, binary.LittleEndian, bits); err != nil {
+		return err
+	}
+
+	b.Lock()
+	b.bits, b.m, b.k, b.items = bits, m, k, items
+	b.Unlock()
+	return nil
+}
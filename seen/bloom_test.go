@@ -0,0 +1,80 @@
+package seen
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBloom(t *testing.T) {
+	b, err := newBloom(1000, 0.01)
+	assert.Nil(t, err)
+	// ~9.6 bits and 7 hash functions per item for a 1% false positive rate
+	assert.Equal(t, uint64(9586), b.m)
+	assert.Equal(t, uint64(7), b.k)
+	assert.Len(t, b.bits, 150)
+
+	_, err = newBloom(0, 0.01)
+	assert.NotNil(t, err)
+	_, err = newBloom(1000, 1)
+	assert.NotNil(t, err)
+	_, err = newBloom(1000, 0)
+	assert.NotNil(t, err)
+}
+
+func TestBloomSeen(t *testing.T) {
+	cache, err := NewCache("bloom", Config{ExpectedItems: 10000, FalsePositiveRate: 0.01})
+	assert.Nil(t, err)
+
+	for i := 0; i < 10000; i++ {
+		cache.Add(fmt.Sprintf("https://example.com/%d", i))
+	}
+	// No false negatives
+	for i := 0; i < 10000; i++ {
+		assert.True(t, cache.Seen(fmt.Sprintf("https://example.com/%d", i)))
+	}
+	// False positives stay around the configured rate
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if cache.Seen(fmt.Sprintf("https://example.com/never-seen/%d", i)) {
+			falsePositives++
+		}
+	}
+	assert.True(t, falsePositives < 200, "%d false positives", falsePositives)
+}
+
+func TestBloomStats(t *testing.T) {
+	cache, _ := NewCache("bloom", Config{ExpectedItems: 1000, FalsePositiveRate: 0.01})
+	stats := cache.(Reporter).Stats()
+	assert.Equal(t, Stats{}, stats)
+
+	for i := 0; i < 1000; i++ {
+		cache.Add(fmt.Sprintf("https://example.com/%d", i))
+	}
+	cache.Add("https://example.com/1")
+
+	stats = cache.(Reporter).Stats()
+	assert.InDelta(t, 1000, stats.Items, 5)
+	// A filter at capacity is about half full
+	assert.InDelta(t, 0.5, stats.FillRatio, 0.05)
+	assert.InDelta(t, 0.01, stats.FalsePositiveRate, 0.005)
+}
+
+func TestBloomSaveLoad(t *testing.T) {
+	cache, _ := NewCache("bloom", Config{ExpectedItems: 1000, FalsePositiveRate: 0.01})
+	cache.Add("https://example.com/")
+	cache.Add("https://example.com/about-us")
+
+	var buf bytes.Buffer
+	assert.Nil(t, cache.(Persistent).Save(&buf))
+
+	restored, _ := NewCache("bloom", Config{ExpectedItems: 10, FalsePositiveRate: 0.1})
+	assert.Nil(t, restored.(Persistent).Load(&buf))
+	assert.Equal(t, cache, restored)
+	assert.True(t, restored.Seen("https://example.com/"))
+	assert.False(t, restored.Seen("https://example.com/contact"))
+
+	assert.NotNil(t, restored.(Persistent).Load(bytes.NewReader([]byte("garbage"))))
+}
@@ -1,24 +1,86 @@
 package seen
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
 
 var cacheEngines map[string]bool
 
-const inMemoryCache = "in-memory"
+const (
+	inMemoryCache = "in-memory"
+	bloomCache    = "bloom"
+	diskCache     = "disk"
+	redisCache    = "redis"
+)
 
 func init() {
 	cacheEngines = make(map[string]bool)
 	cacheEngines[inMemoryCache] = true
+	cacheEngines[bloomCache] = true
+	cacheEngines[diskCache] = true
+	cacheEngines[redisCache] = true
+}
+
+// Config represents seen cache configuration
+type Config struct {
+	// Number of urls the bloom filter is sized for
+	ExpectedItems uint64
+	// Accepted rate of never seen urls reported as seen by the bloom filter
+	FalsePositiveRate float64
+	// Database file of the disk cache
+	Path string
+	// Redis server of the redis cache, like redis://localhost:6379/0
+	RedisURL string
+	// Prefix of the redis cache keys, crawls sharing a prefix share the seen set
+	RedisPrefix string
+	// Max number of connections to Redis
+	RedisPoolSize int
+	// How long a url stays seen, 0 means forever. Not supported by the bloom filter
+	TTL time.Duration
+	// Per host overrides of `TTL`
+	HostTTL map[string]time.Duration
 }
 
 // Cache provides an interface to keep track of seen urls.
 type Cache interface {
 	Seen(url string) bool
 	Add(url string) error
+	// AddIfAbsent adds `url` and returns `true` only if it was not seen before, as a single atomic operation
+	AddIfAbsent(url string) (bool, error)
+}
+
+// Persistent is implemented by caches that can be written to a checkpoint and read back from it.
+// Engines that already keep their data outside the process don't need it.
+type Persistent interface {
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+}
+
+// Stats describes how full a cache is
+type Stats struct {
+	// Number of urls added
+	Items uint64
+	// Fraction of the cache capacity in use
+	FillRatio float64
+	// Estimated probability of reporting a never seen url as seen
+	FalsePositiveRate float64
+}
+
+// Compactor is implemented by caches that can reclaim unused space
+type Compactor interface {
+	Compact() error
+}
+
+// Reporter is implemented by caches that can report their `Stats`
+type Reporter interface {
+	Stats() Stats
 }
 
 // NewCache returns the `kind` specific `Cache` implementation
-func NewCache(kind string) (Cache, error) {
+func NewCache(kind string, cfg Config) (Cache, error) {
 	if !cacheEngines[kind] {
 		return nil, fmt.Errorf("cache engine %s not supported", kind)
 	}
@@ -29,10 +91,35 @@ func NewCache(kind string) (Cache, error) {
 	switch kind {
 	case inMemoryCache:
 		im := &inMemory{
-			seen: make(map[string]bool),
+			seen:   make(map[string]time.Time),
+			expiry: newExpiry(cfg),
 		}
 		cache = im
 		err = nil
+	case bloomCache:
+		if cfg.TTL > 0 || len(cfg.HostTTL) > 0 {
+			return nil, errors.New("bloom cache entries can't expire, ttl is not supported")
+		}
+		var b *bloom
+		b, err = newBloom(cfg.ExpectedItems, cfg.FalsePositiveRate)
+		if err != nil {
+			return nil, err
+		}
+		cache = b
+	case diskCache:
+		var d *disk
+		d, err = newDisk(cfg.Path, newExpiry(cfg))
+		if err != nil {
+			return nil, err
+		}
+		cache = d
+	case redisCache:
+		var r *redisSeen
+		r, err = newRedis(cfg)
+		if err != nil {
+			return nil, err
+		}
+		cache = r
 	}
 	return cache, err
 }
@@ -8,13 +8,21 @@ import (
 )
 
 func TestNewCache(t *testing.T) {
-	cache, err := NewCache("in-memory")
+	cache, err := NewCache("in-memory", Config{})
 	assert.Nil(t, err)
 	assert.NotNil(t, cache)
 	assert.IsType(t, new(inMemory), cache)
 	assert.Implements(t, new(Cache), cache)
 
-	notImplementedCache, err := NewCache("not-implemented")
+	bloomCache, err := NewCache("bloom", Config{ExpectedItems: 1000, FalsePositiveRate: 0.01})
+	assert.Nil(t, err)
+	assert.IsType(t, new(bloom), bloomCache)
+	assert.Implements(t, new(Cache), bloomCache)
+
+	_, err = NewCache("bloom", Config{})
+	assert.NotNil(t, err)
+
+	notImplementedCache, err := NewCache("not-implemented", Config{})
 	assert.EqualError(t, err, fmt.Sprintf("cache engine %s not supported", "not-implemented"))
 	assert.Nil(t, notImplementedCache)
 }
@@ -0,0 +1,188 @@
+package seen
+
+import (
+	"encoding/binary"
+	"os"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var seenBucket = []byte("seen")
+
+// disk is a seen cache stored in an embedded bolt database, so it survives restarts
+// and is not bounded by memory. Every url is stored along with the time it was added.
+type disk struct {
+	// Guards `db`, which is swapped while compacting
+	sync.RWMutex
+	db   *bolt.DB
+	path string
+	expiry
+}
+
+func openBolt(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	// Writes reach the OS right away, so they survive the process being killed. Skipping the fsync
+	// per url keeps the frontier fast; the file is synced on `Close`.
+	db.NoSync = true
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(seenBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func newDisk(path string, e expiry) (*disk, error) {
+	db, err := openBolt(path)
+	if err != nil {
+		return nil, err
+	}
+	return &disk{db: db, path: path, expiry: e}, nil
+}
+
+func timestamp(t time.Time) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(t.UnixNano()))
+	return b
+}
+
+func parseTimestamp(b []byte) time.Time {
+	if len(b) != 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+}
+
+// live returns `true` if `value`, as stored for `url`, exists and has not expired
+func (d *disk) live(url string, value []byte) bool {
+	return value != nil && !d.expired(url, parseTimestamp(value))
+}
+
+// Seen returns `true` if `url` is in the database, `false` otherwise.
+func (d *disk) Seen(url string) bool {
+	d.RLock()
+	defer d.RUnlock()
+	seen := false
+	d.db.View(func(tx *bolt.Tx) error {
+		seen = d.live(url, tx.Bucket(seenBucket).Get([]byte(url)))
+		return nil
+	})
+	return seen
+}
+
+// Add will insert a new `url` in the database
+func (d *disk) Add(url string) error {
+	d.RLock()
+	defer d.RUnlock()
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(seenBucket).Put([]byte(url), timestamp(d.now()))
+	})
+}
+
+// AddIfAbsent inserts `url` in the database, returning `false` if it was already there and has not expired
+func (d *disk) AddIfAbsent(url string) (bool, error) {
+	d.RLock()
+	defer d.RUnlock()
+	var added bool
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(seenBucket)
+		if d.live(url, b.Get([]byte(url))) {
+			return nil
+		}
+		added = true
+		return b.Put([]byte(url), timestamp(d.now()))
+	})
+	if err != nil {
+		return false, err
+	}
+	return added, nil
+}
+
+// Stats returns the number of urls in the database
+func (d *disk) Stats() Stats {
+	d.RLock()
+	defer d.RUnlock()
+	var items uint64
+	d.db.View(func(tx *bolt.Tx) error {
+		items = uint64(tx.Bucket(seenBucket).Stats().KeyN)
+		return nil
+	})
+	return Stats{Items: items}
+}
+
+// purge deletes the expired urls
+func (d *disk) purge() error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(seenBucket)
+		expired := [][]byte{}
+		err := b.ForEach(func(k, v []byte) error {
+			if !d.live(string(k), v) {
+				expired = append(expired, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Compact deletes the expired urls and rewrites the database into a new file, giving the space back to the filesystem
+func (d *disk) Compact() error {
+	d.Lock()
+	defer d.Unlock()
+
+	if err := d.purge(); err != nil {
+		return err
+	}
+
+	tmpPath := d.path + ".compact"
+	os.Remove(tmpPath)
+	dst, err := bolt.Open(tmpPath, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return err
+	}
+	if err := bolt.Compact(dst, d.db, 64*1024*1024); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := d.db.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, d.path); err != nil {
+		return err
+	}
+
+	d.db, err = openBolt(d.path)
+	return err
+}
+
+// Close flushes and releases the database file
+func (d *disk) Close() error {
+	d.Lock()
+	defer d.Unlock()
+	if err := d.db.Sync(); err != nil {
+		d.db.Close()
+		return err
+	}
+	return d.db.Close()
+}
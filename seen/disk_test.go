@@ -0,0 +1,131 @@
+package seen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempDB(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "wanna-crawl-seen")
+	assert.Nil(t, err)
+	return filepath.Join(dir, "seen.db"), func() { os.RemoveAll(dir) }
+}
+
+func TestDiskSeen(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+
+	cache, err := NewCache("disk", Config{Path: path})
+	assert.Nil(t, err)
+	cache.Add("https://example.com/")
+	assert.True(t, cache.Seen("https://example.com/"))
+	assert.False(t, cache.Seen("https://example.com/about-us"))
+
+	added, err := cache.AddIfAbsent("https://example.com/about-us")
+	assert.Nil(t, err)
+	assert.True(t, added)
+	added, err = cache.AddIfAbsent("https://example.com/about-us")
+	assert.Nil(t, err)
+	assert.False(t, added)
+	assert.Equal(t, uint64(2), cache.(Reporter).Stats().Items)
+}
+
+func TestDiskSurvivesRestarts(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+
+	cache, _ := NewCache("disk", Config{Path: path})
+	cache.Add("https://example.com/")
+	assert.Nil(t, cache.(*disk).Close())
+
+	cache, err := NewCache("disk", Config{Path: path})
+	assert.Nil(t, err)
+	defer cache.(*disk).Close()
+	assert.True(t, cache.Seen("https://example.com/"))
+	added, _ := cache.AddIfAbsent("https://example.com/")
+	assert.False(t, added)
+}
+
+func TestDiskCompact(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+
+	cache, _ := NewCache("disk", Config{Path: path})
+	defer cache.(*disk).Close()
+	for i := 0; i < 1000; i++ {
+		cache.Add(fmt.Sprintf("https://example.com/%d", i))
+	}
+
+	assert.Nil(t, cache.(Compactor).Compact())
+	for i := 0; i < 1000; i++ {
+		assert.True(t, cache.Seen(fmt.Sprintf("https://example.com/%d", i)))
+	}
+	assert.False(t, cache.Seen("https://example.com/never-seen"))
+	// Still writable after compacting
+	added, err := cache.AddIfAbsent("https://example.com/never-seen")
+	assert.Nil(t, err)
+	assert.True(t, added)
+}
+
+func TestDiskAddIfAbsentConcurrently(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+
+	cache, _ := NewCache("disk", Config{Path: path})
+	defer cache.(*disk).Close()
+
+	var wg sync.WaitGroup
+	var added int32
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Each url is raced by two goroutines
+			if ok, _ := cache.AddIfAbsent(fmt.Sprintf("https://example.com/%d", i/2)); ok {
+				atomic.AddInt32(&added, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(32), added)
+}
+
+func TestDiskLocked(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+
+	cache, _ := NewCache("disk", Config{Path: path})
+	defer cache.(*disk).Close()
+
+	// A second process can't open the same database
+	_, err := NewCache("disk", Config{Path: path})
+	assert.NotNil(t, err)
+}
+
+func TestDiskCompactPurgesExpired(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+
+	cache, _ := NewCache("disk", Config{Path: path, TTL: time.Hour})
+	d := cache.(*disk)
+	defer d.Close()
+	clock := &fakeClock{t: time.Now()}
+	d.now = clock.now
+
+	cache.Add("https://example.com/old")
+	clock.advance(2 * time.Hour)
+	cache.Add("https://example.com/new")
+
+	assert.Nil(t, d.Compact())
+	assert.Equal(t, uint64(1), d.Stats().Items)
+	assert.True(t, cache.Seen("https://example.com/new"))
+	assert.False(t, cache.Seen("https://example.com/old"))
+}
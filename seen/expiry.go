@@ -0,0 +1,64 @@
+package seen
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+// expiry decides when a seen url becomes eligible to be crawled again
+type expiry struct {
+	// How long a url stays seen, 0 means forever
+	ttl time.Duration
+	// Per host overrides of `ttl`
+	hostTTL map[string]time.Duration
+	// Replaced in tests
+	now func() time.Time
+}
+
+func newExpiry(cfg Config) expiry {
+	return expiry{
+		ttl:     cfg.TTL,
+		hostTTL: cfg.HostTTL,
+		now:     time.Now,
+	}
+}
+
+// ttlFor returns how long `url` stays seen
+func (e expiry) ttlFor(url string) time.Duration {
+	if len(e.hostTTL) > 0 {
+		if u, err := neturl.Parse(url); err == nil {
+			if ttl, ok := e.hostTTL[strings.ToLower(u.Hostname())]; ok {
+				return ttl
+			}
+		}
+	}
+	return e.ttl
+}
+
+// expired returns `true` if `url`, seen at `added`, has aged out
+func (e expiry) expired(url string, added time.Time) bool {
+	ttl := e.ttlFor(url)
+	return ttl > 0 && e.now().Sub(added) >= ttl
+}
+
+// ParseHostTTL parses a comma separated list of `host=duration` pairs, like `example.com=1h,blog.example.com=24h`
+func ParseHostTTL(s string) (map[string]time.Duration, error) {
+	hostTTL := map[string]time.Duration{}
+	if strings.TrimSpace(s) == "" {
+		return hostTTL, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("malformed host ttl %q, expected host=duration", pair)
+		}
+		ttl, err := time.ParseDuration(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, fmt.Errorf("malformed host ttl %q: %v", pair, err)
+		}
+		hostTTL[strings.ToLower(strings.TrimSpace(kv[0]))] = ttl
+	}
+	return hostTTL, nil
+}
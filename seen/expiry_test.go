@@ -0,0 +1,109 @@
+package seen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock lets tests move time forward
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func TestParseHostTTL(t *testing.T) {
+	hostTTL, err := ParseHostTTL("example.com=1h, Blog.Example.com=24h")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]time.Duration{"example.com": time.Hour, "blog.example.com": 24 * time.Hour}, hostTTL)
+
+	hostTTL, err = ParseHostTTL("")
+	assert.Nil(t, err)
+	assert.Empty(t, hostTTL)
+
+	_, err = ParseHostTTL("example.com")
+	assert.NotNil(t, err)
+	_, err = ParseHostTTL("example.com=soon")
+	assert.NotNil(t, err)
+	_, err = ParseHostTTL("=1h")
+	assert.NotNil(t, err)
+}
+
+func TestExpiry(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	e := newExpiry(Config{TTL: time.Hour, HostTTL: map[string]time.Duration{"news.example.com": time.Minute}})
+	e.now = clock.now
+
+	assert.Equal(t, time.Hour, e.ttlFor("https://example.com/"))
+	assert.Equal(t, time.Minute, e.ttlFor("https://NEWS.example.com/today"))
+
+	added := clock.now()
+	clock.advance(2 * time.Minute)
+	assert.False(t, e.expired("https://example.com/", added))
+	assert.True(t, e.expired("https://news.example.com/today", added))
+
+	clock.advance(time.Hour)
+	assert.True(t, e.expired("https://example.com/", added))
+
+	// No ttl means urls are seen forever
+	forever := newExpiry(Config{})
+	assert.False(t, forever.expired("https://example.com/", time.Time{}))
+}
+
+func TestTTL(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+
+	cfg := Config{
+		TTL:     time.Hour,
+		HostTTL: map[string]time.Duration{"news.example.com": time.Minute},
+		Path:    path,
+	}
+	for _, engine := range []string{"in-memory", "disk"} {
+		cache, err := NewCache(engine, cfg)
+		assert.Nil(t, err)
+
+		clock := &fakeClock{t: time.Now()}
+		switch c := cache.(type) {
+		case *inMemory:
+			c.now = clock.now
+		case *disk:
+			c.now = clock.now
+		}
+
+		cache.Add("https://example.com/")
+		cache.Add("https://news.example.com/today")
+
+		clock.advance(2 * time.Minute)
+		assert.True(t, cache.Seen("https://example.com/"), engine)
+		assert.False(t, cache.Seen("https://news.example.com/today"), engine)
+
+		// Expired urls can be added again, and stay seen for another ttl
+		added, _ := cache.AddIfAbsent("https://news.example.com/today")
+		assert.True(t, added, engine)
+		added, _ = cache.AddIfAbsent("https://news.example.com/today")
+		assert.False(t, added, engine)
+
+		clock.advance(time.Hour)
+		assert.False(t, cache.Seen("https://example.com/"), engine)
+		added, _ = cache.AddIfAbsent("https://example.com/")
+		assert.True(t, added, engine)
+
+		if d, ok := cache.(*disk); ok {
+			d.Close()
+		}
+	}
+}
+
+func TestBloomTTLNotSupported(t *testing.T) {
+	_, err := NewCache("bloom", Config{ExpectedItems: 1000, FalsePositiveRate: 0.01, TTL: time.Hour})
+	assert.EqualError(t, err, "bloom cache entries can't expire, ttl is not supported")
+}
@@ -1,25 +1,64 @@
 package seen
 
-import "sync"
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
 
 // inMemory is a basic implementation of the seen cache using a map.
 type inMemory struct {
 	sync.RWMutex
-	seen map[string]bool
+	// When every url was seen
+	seen map[string]time.Time
+	expiry
 }
 
 //Seen returns `true` if `url` is in `seen` cache, `false` otherwise.
 func (im *inMemory) Seen(url string) bool {
 	im.RLock()
-	s := im.seen[url]
+	added, s := im.seen[url]
 	im.RUnlock()
-	return s
+	return s && !im.expired(url, added)
 }
 
 //Add will insert a new `url` in `seen` cache
 func (im *inMemory) Add(url string) error {
 	im.Lock()
-	im.seen[url] = true
+	im.seen[url] = im.now()
+	im.Unlock()
+	return nil
+}
+
+// AddIfAbsent inserts `url` in `seen` cache, returning `false` if it was already there and has not expired
+func (im *inMemory) AddIfAbsent(url string) (bool, error) {
+	im.Lock()
+	defer im.Unlock()
+	if added, ok := im.seen[url]; ok && !im.expired(url, added) {
+		return false, nil
+	}
+	im.seen[url] = im.now()
+	return true, nil
+}
+
+// Save writes the seen urls, along with when they were seen, to `w` as a JSON object
+func (im *inMemory) Save(w io.Writer) error {
+	im.RLock()
+	defer im.RUnlock()
+	return json.NewEncoder(w).Encode(im.seen)
+}
+
+// Load adds the urls saved by `Save` to the `seen` cache
+func (im *inMemory) Load(r io.Reader) error {
+	seen := map[string]time.Time{}
+	if err := json.NewDecoder(r).Decode(&seen); err != nil {
+		return err
+	}
+	im.Lock()
+	for u, added := range seen {
+		im.seen[u] = added
+	}
 	im.Unlock()
 	return nil
 }
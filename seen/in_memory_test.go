@@ -1,14 +1,54 @@
 package seen
 
 import (
+	"bytes"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestSeen(t *testing.T) {
-	cache, _ := NewCache("in-memory")
+	cache, _ := NewCache("in-memory", Config{})
 	cache.Add("https://example.com/")
 	assert.True(t, cache.Seen("https://example.com/"))
 	assert.False(t, cache.Seen("https://example.com/about-us"))
 }
+
+func TestSaveLoad(t *testing.T) {
+	cache, _ := NewCache("in-memory", Config{})
+	cache.Add("https://example.com/")
+	cache.Add("https://example.com/about-us")
+
+	var buf bytes.Buffer
+	assert.Nil(t, cache.(Persistent).Save(&buf))
+
+	restored, _ := NewCache("in-memory", Config{})
+	assert.Nil(t, restored.(Persistent).Load(&buf))
+	assert.True(t, restored.Seen("https://example.com/"))
+	assert.True(t, restored.Seen("https://example.com/about-us"))
+	assert.False(t, restored.Seen("https://example.com/contact"))
+}
+
+func TestAddIfAbsent(t *testing.T) {
+	for _, engine := range []string{"in-memory", "bloom"} {
+		cache, _ := NewCache(engine, Config{ExpectedItems: 1000, FalsePositiveRate: 0.01})
+
+		var wg sync.WaitGroup
+		var added int32
+		for i := 0; i < 64; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if ok, _ := cache.AddIfAbsent("https://example.com/"); ok {
+					atomic.AddInt32(&added, 1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), added, engine)
+		assert.True(t, cache.Seen("https://example.com/"), engine)
+	}
+}
@@ -0,0 +1,91 @@
+package seen
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// redisSeen is a seen cache stored in Redis, so several processes can share it.
+// Every url is a key under `prefix`, expiring natively when a ttl is set.
+type redisSeen struct {
+	pool   *redis.Pool
+	prefix string
+	expiry
+}
+
+func newRedis(cfg Config) (*redisSeen, error) {
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(cfg.RedisURL, redis.DialConnectTimeout(5*time.Second))
+		},
+		TestOnBorrow: func(c redis.Conn, idleSince time.Time) error {
+			if time.Since(idleSince) < time.Minute {
+				return nil
+			}
+			_, err := c.Do("PING")
+			return err
+		},
+		MaxIdle:     cfg.RedisPoolSize,
+		MaxActive:   cfg.RedisPoolSize,
+		IdleTimeout: 5 * time.Minute,
+		// Workers wait for a connection instead of failing when the pool is exhausted
+		Wait: true,
+	}
+
+	// Fail fast if Redis is not reachable
+	conn := pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return &redisSeen{
+		pool:   pool,
+		prefix: cfg.RedisPrefix + ":",
+		expiry: newExpiry(cfg),
+	}, nil
+}
+
+// set stores `url` with the SET `options` given, plus its ttl if any
+func (r *redisSeen) set(url string, options ...interface{}) (interface{}, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	args := []interface{}{r.prefix + url, r.now().UnixNano()}
+	args = append(args, options...)
+	if ttl := r.ttlFor(url); ttl > 0 {
+		args = append(args, "PX", int64(ttl/time.Millisecond))
+	}
+	return conn.Do("SET", args...)
+}
+
+// Seen returns `true` if `url` is in Redis, `false` otherwise or if Redis can't be reached.
+func (r *redisSeen) Seen(url string) bool {
+	conn := r.pool.Get()
+	defer conn.Close()
+	seen, err := redis.Bool(conn.Do("EXISTS", r.prefix+url))
+	return err == nil && seen
+}
+
+// Add will insert a new `url` in Redis
+func (r *redisSeen) Add(url string) error {
+	_, err := r.set(url)
+	return err
+}
+
+// AddIfAbsent inserts `url` in Redis with SET NX, returning `false` if it was already there
+func (r *redisSeen) AddIfAbsent(url string) (bool, error) {
+	reply, err := r.set(url, "NX")
+	if err != nil {
+		return false, err
+	}
+	// SET NX replies nil when the key already exists
+	return reply != nil, nil
+}
+
+// Close releases the connection pool
+func (r *redisSeen) Close() error {
+	return r.pool.Close()
+}
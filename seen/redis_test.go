@@ -0,0 +1,104 @@
+package seen
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func redisConfig(t *testing.T) (Config, *miniredis.Miniredis) {
+	server, err := miniredis.Run()
+	assert.Nil(t, err)
+	return Config{
+		RedisURL:      "redis://" + server.Addr(),
+		RedisPrefix:   "crawl-1",
+		RedisPoolSize: 4,
+	}, server
+}
+
+func TestRedisSeen(t *testing.T) {
+	cfg, server := redisConfig(t)
+	defer server.Close()
+
+	cache, err := NewCache("redis", cfg)
+	assert.Nil(t, err)
+	defer cache.(*redisSeen).Close()
+
+	assert.Nil(t, cache.Add("https://example.com/"))
+	assert.True(t, cache.Seen("https://example.com/"))
+	assert.False(t, cache.Seen("https://example.com/about-us"))
+	assert.True(t, server.Exists("crawl-1:https://example.com/"))
+
+	added, err := cache.AddIfAbsent("https://example.com/about-us")
+	assert.Nil(t, err)
+	assert.True(t, added)
+	added, err = cache.AddIfAbsent("https://example.com/about-us")
+	assert.Nil(t, err)
+	assert.False(t, added)
+}
+
+func TestRedisSharedAcrossProcesses(t *testing.T) {
+	cfg, server := redisConfig(t)
+	defer server.Close()
+
+	// Two crawls with the same prefix share the seen set, a different prefix does not
+	a, _ := NewCache("redis", cfg)
+	b, _ := NewCache("redis", cfg)
+	other := cfg
+	other.RedisPrefix = "crawl-2"
+	c, _ := NewCache("redis", other)
+
+	a.Add("https://example.com/")
+	assert.True(t, b.Seen("https://example.com/"))
+	assert.False(t, c.Seen("https://example.com/"))
+
+	var wg sync.WaitGroup
+	var added int32
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			cache := a
+			if i%2 == 0 {
+				cache = b
+			}
+			if ok, _ := cache.AddIfAbsent(fmt.Sprintf("https://example.com/%d", i/2)); ok {
+				atomic.AddInt32(&added, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(32), added)
+}
+
+func TestRedisTTL(t *testing.T) {
+	cfg, server := redisConfig(t)
+	defer server.Close()
+	cfg.TTL = time.Hour
+	cfg.HostTTL = map[string]time.Duration{"news.example.com": time.Minute}
+
+	cache, _ := NewCache("redis", cfg)
+	cache.Add("https://example.com/")
+	cache.AddIfAbsent("https://news.example.com/today")
+	assert.Equal(t, time.Hour, server.TTL("crawl-1:https://example.com/"))
+	assert.Equal(t, time.Minute, server.TTL("crawl-1:https://news.example.com/today"))
+
+	server.FastForward(2 * time.Minute)
+	assert.True(t, cache.Seen("https://example.com/"))
+	assert.False(t, cache.Seen("https://news.example.com/today"))
+	added, _ := cache.AddIfAbsent("https://news.example.com/today")
+	assert.True(t, added)
+}
+
+func TestRedisUnreachable(t *testing.T) {
+	cfg, server := redisConfig(t)
+	server.Close()
+
+	_, err := NewCache("redis", cfg)
+	assert.NotNil(t, err)
+}
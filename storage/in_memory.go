@@ -2,28 +2,111 @@ package storage
 
 import (
 	"encoding/json"
+	"io"
+	"sort"
 	"sync"
 )
 
 type inMemory struct {
 	sync.RWMutex
-	db map[string][]string
+	db map[string]*Page
 }
 
-func (im *inMemory) Store(u string, l []string) error {
+func (im *inMemory) Store(p *Page) error {
 	im.Lock()
-	im.db[u] = l
+	im.db[p.URL] = p
 	im.Unlock()
 	return nil
 }
 
 func (im *inMemory) Dump() (string, error) {
 	im.RLock()
-	db := im.db
+	jsonData, err := json.MarshalIndent(im.db, "", "\t")
 	im.RUnlock()
-	jsonData, err := json.MarshalIndent(db, "", "\t")
 	if err != nil {
 		return "", err
 	}
 	return string(jsonData), nil
 }
+
+func (im *inMemory) Walk(fn func(p *Page) error) error {
+	im.RLock()
+	defer im.RUnlock()
+	for _, p := range im.db {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (im *inMemory) Inbound(url string) ([]Edge, error) {
+	im.RLock()
+	defer im.RUnlock()
+	edges := []Edge{}
+	for from, p := range im.db {
+		for _, l := range p.Links {
+			if l.URL == url {
+				edges = append(edges, Edge{From: from, To: url, Text: l.Text})
+			}
+		}
+	}
+	sortEdges(edges)
+	return edges, nil
+}
+
+func (im *inMemory) Orphans() ([]*Page, error) {
+	im.RLock()
+	defer im.RUnlock()
+	return orphans(im.db), nil
+}
+
+func (im *inMemory) BrokenLinks() ([]BrokenLink, error) {
+	im.RLock()
+	defer im.RUnlock()
+	broken := []BrokenLink{}
+	for from, p := range im.db {
+		for _, l := range p.Links {
+			if target, ok := im.db[l.URL]; ok && target.Error != "" {
+				broken = append(broken, BrokenLink{
+					Edge:       Edge{From: from, To: l.URL, Text: l.Text},
+					StatusCode: target.StatusCode,
+					Error:      target.Error,
+				})
+			}
+		}
+	}
+	sort.Slice(broken, func(i, j int) bool {
+		if broken[i].From != broken[j].From {
+			return broken[i].From < broken[j].From
+		}
+		return broken[i].To < broken[j].To
+	})
+	return broken, nil
+}
+
+func (im *inMemory) AtDepth(depth int) ([]*Page, error) {
+	im.RLock()
+	defer im.RUnlock()
+	return atDepth(im.db, depth), nil
+}
+
+func (im *inMemory) Save(w io.Writer) error {
+	im.RLock()
+	defer im.RUnlock()
+	return json.NewEncoder(w).Encode(im.db)
+}
+
+func (im *inMemory) Load(r io.Reader) error {
+	db := map[string]*Page{}
+	if err := json.NewDecoder(r).Decode(&db); err != nil {
+		return err
+	}
+	im.Lock()
+	for u, p := range db {
+		p.URL = u
+		im.db[u] = p
+	}
+	im.Unlock()
+	return nil
+}
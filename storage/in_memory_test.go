@@ -1,15 +1,54 @@
 package storage
 
 import (
+	"bytes"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestDump(t *testing.T) {
-	storage, _ := NewStorage("in-memory")
-	storage.Store("https://example.com/", []string{"https://example.com/about-us/"})
+	storage, _ := NewStorage("in-memory", Config{})
+	storage.Store(&Page{URL: "https://example.com/", StatusCode: 200, Links: []Link{{URL: "https://example.com/about-us/", Text: "About us"}}})
 	sitemap, err := storage.Dump()
 	assert.Nil(t, err)
 	assert.NotEmpty(t, sitemap)
 }
+
+func TestSaveLoad(t *testing.T) {
+	db, _ := NewStorage("in-memory", Config{})
+	db.Store(&Page{URL: "https://example.com/", StatusCode: 200, Links: []Link{{URL: "https://example.com/about-us/", Text: "About us"}}})
+	db.Store(&Page{URL: "https://example.com/about-us/", Depth: 1, StatusCode: 404, Error: "not found"})
+
+	var buf bytes.Buffer
+	assert.Nil(t, db.(Persistent).Save(&buf))
+
+	restored, _ := NewStorage("in-memory", Config{})
+	assert.Nil(t, restored.(Persistent).Load(&buf))
+	assert.Equal(t, db, restored)
+}
+
+func TestWalk(t *testing.T) {
+	cfg, cleanup := tempSQLite(t)
+	defer cleanup()
+	sqliteDB, _ := NewStorage("sqlite", cfg)
+	defer sqliteDB.(*sqlite).Close()
+	inMemoryDB, _ := NewStorage("in-memory", Config{})
+
+	for _, db := range []Storage{inMemoryDB, sqliteDB} {
+		for _, p := range samplePages {
+			db.Store(p)
+		}
+		walked := map[string]int{}
+		err := db.(Walker).Walk(func(p *Page) error {
+			walked[p.URL] = p.StatusCode
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]int{"https://example.com/": 200, "https://example.com/about-us": 200, "https://example.com/missing": 404}, walked)
+
+		stop := errors.New("stop")
+		assert.Equal(t, stop, db.(Walker).Walk(func(p *Page) error { return stop }))
+	}
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// record is a single line of the jsonl storage
+type record struct {
+	URL string `json:"url"`
+	*Page
+}
+
+// jsonl appends every page, one JSON object per line, as soon as it is stored,
+// so the output can be tailed while the crawl runs.
+type jsonl struct {
+	sync.Mutex
+	w *bufio.Writer
+	// The file being written, nil when writing to stdout
+	file *os.File
+	// Whether to fsync the file on every flush
+	fsync bool
+	// Whether every record is flushed right away
+	flushEvery bool
+	// To stop the periodic flushes
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newJSONL writes to the file at `path`, appending to it if it already exists, or to stdout if `path` is `-`.
+func newJSONL(path string, cfg Config) (*jsonl, error) {
+	j := &jsonl{
+		fsync:      cfg.Fsync,
+		flushEvery: cfg.FlushInterval <= 0,
+		stop:       make(chan struct{}),
+	}
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		j.file = f
+		out = f
+	}
+	j.w = bufio.NewWriter(out)
+
+	if !j.flushEvery {
+		j.wg.Add(1)
+		go j.flushPeriodically(cfg.FlushInterval)
+	}
+	return j, nil
+}
+
+func (j *jsonl) flushPeriodically(interval time.Duration) {
+	defer j.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			j.Lock()
+			j.flush()
+			j.Unlock()
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// flush writes the buffered records. Callers must hold the lock.
+func (j *jsonl) flush() error {
+	if err := j.w.Flush(); err != nil {
+		return err
+	}
+	if j.fsync && j.file != nil {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+func (j *jsonl) Store(p *Page) error {
+	line, err := json.Marshal(record{URL: p.URL, Page: p})
+	if err != nil {
+		return err
+	}
+	j.Lock()
+	defer j.Unlock()
+	if _, err := j.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if j.flushEvery {
+		return j.flush()
+	}
+	return nil
+}
+
+// Dump returns nothing, every page has already been written as it was stored
+func (j *jsonl) Dump() (string, error) {
+	return "", nil
+}
+
+// Close flushes the pending records and releases the file
+func (j *jsonl) Close() error {
+	close(j.stop)
+	j.wg.Wait()
+
+	j.Lock()
+	defer j.Unlock()
+	err := j.flush()
+	if j.file != nil {
+		if cerr := j.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
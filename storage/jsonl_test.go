@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readRecords(t *testing.T, path string) []map[string]interface{} {
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	records := []map[string]interface{}{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &r), scanner.Text())
+		records = append(records, r)
+	}
+	return records
+}
+
+func tempJSONL(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "wanna-crawl-storage")
+	assert.Nil(t, err)
+	return filepath.Join(dir, "crawl.jsonl"), func() { os.RemoveAll(dir) }
+}
+
+func TestJSONLStore(t *testing.T) {
+	path, cleanup := tempJSONL(t)
+	defer cleanup()
+
+	db, err := NewStorage("jsonl", Config{Path: path})
+	assert.Nil(t, err)
+	defer db.(*jsonl).Close()
+	for _, p := range samplePages {
+		assert.Nil(t, db.Store(p))
+	}
+
+	// Every record is readable right away
+	records := readRecords(t, path)
+	assert.Len(t, records, len(samplePages))
+	assert.Equal(t, "https://example.com/", records[0]["url"])
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"url": "https://example.com/about-us", "text": "About us", "kind": "a", "nofollow": true},
+		map[string]interface{}{"url": "https://example.com/missing", "kind": "img"},
+	}, records[0]["links"])
+	assert.Equal(t, "https://example.com/missing", records[2]["url"])
+	assert.Equal(t, float64(404), records[2]["status"])
+
+	// Nothing left to dump
+	sitemap, err := db.Dump()
+	assert.Nil(t, err)
+	assert.Empty(t, sitemap)
+}
+
+func TestJSONLFlushInterval(t *testing.T) {
+	path, cleanup := tempJSONL(t)
+	defer cleanup()
+
+	db, _ := NewStorage("jsonl", Config{Path: path, FlushInterval: 50 * time.Millisecond, Fsync: true})
+	db.Store(samplePages[0])
+	assert.Empty(t, readRecords(t, path))
+	time.Sleep(150 * time.Millisecond)
+	assert.Len(t, readRecords(t, path), 1)
+
+	// Closing flushes whatever is buffered
+	db.Store(samplePages[1])
+	assert.Nil(t, db.(*jsonl).Close())
+	assert.Len(t, readRecords(t, path), 2)
+}
+
+func TestJSONLAppends(t *testing.T) {
+	path, cleanup := tempJSONL(t)
+	defer cleanup()
+
+	db, _ := NewStorage("jsonl", Config{Path: path})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			db.Store(&Page{URL: fmt.Sprintf("https://example.com/%d", i), StatusCode: 200})
+		}(i)
+	}
+	wg.Wait()
+	db.(*jsonl).Close()
+
+	// A resumed crawl keeps the records of the previous run
+	db, _ = NewStorage("jsonl", Config{Path: path})
+	db.Store(&Page{URL: "https://example.com/resumed", StatusCode: 200})
+	db.(*jsonl).Close()
+	assert.Len(t, readRecords(t, path), 51)
+}
@@ -0,0 +1,47 @@
+package storage
+
+import "time"
+
+// Link is an edge between two pages
+type Link struct {
+	// Where the link points to
+	URL string `json:"url"`
+	// Text of the anchor
+	Text string `json:"text,omitempty"`
+	// Where the link was found, like `a` for anchors or `img` for images
+	Kind string `json:"kind,omitempty"`
+	// Whether the link was not followed, because of its `rel` or the directives of its page
+	Nofollow bool `json:"nofollow,omitempty"`
+}
+
+// Page is the crawling result of a single url
+type Page struct {
+	// The crawled url
+	URL string `json:"-"`
+	// Number of links between the seed and this url
+	Depth int `json:"depth"`
+	// The url the content was served from, after following redirects
+	FinalURL string `json:"final_url,omitempty"`
+	// Urls visited before reaching `FinalURL`
+	Redirects []string `json:"redirects,omitempty"`
+	// HTTP status code, 0 if the url could not be fetched
+	StatusCode int `json:"status,omitempty"`
+	// Value of the Content-Type header
+	ContentType string `json:"content_type,omitempty"`
+	// When the url was fetched, zero if it could not be
+	FetchedAt time.Time `json:"fetched_at"`
+	// Time it took to fetch the url
+	Latency time.Duration `json:"latency,omitempty"`
+	// Number of times the url was requested
+	Attempts int `json:"attempts,omitempty"`
+	// SHA-256 of the body, hex encoded
+	ContentHash string `json:"content_hash,omitempty"`
+	// Whether the page asked not to be indexed, with a robots meta tag or an `X-Robots-Tag` header
+	Noindex bool `json:"noindex,omitempty"`
+	// Why the body was not downloaded, like a content type not allowed or a body too large
+	Skipped string `json:"skipped,omitempty"`
+	// Why the url could not be crawled, empty on success
+	Error string `json:"error,omitempty"`
+	// Links found in the page
+	Links []Link `json:"links"`
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	neturl "net/url"
+	"sort"
+	"strings"
+)
+
+// Edge is a link from a stored page
+type Edge struct {
+	// The page the link was found in
+	From string `json:"from"`
+	// Where the link points to
+	To string `json:"to"`
+	// Text of the anchor
+	Text string `json:"text,omitempty"`
+}
+
+// BrokenLink is a link to a url that could not be crawled
+type BrokenLink struct {
+	Edge
+	// HTTP status code of the target, 0 if it could not be fetched
+	StatusCode int `json:"status,omitempty"`
+	// Why the target could not be crawled
+	Error string `json:"error"`
+}
+
+// Querier is implemented by storages that can answer questions about the link graph.
+// Results are sorted by url.
+type Querier interface {
+	// Inbound returns the links pointing to `url`
+	Inbound(url string) ([]Edge, error)
+	// Orphans returns the pages, seeds included, that no other page of the same host links to
+	Orphans() ([]*Page, error)
+	// BrokenLinks returns the links pointing to urls that could not be crawled
+	BrokenLinks() ([]BrokenLink, error)
+	// AtDepth returns the pages found `depth` links away from the seeds
+	AtDepth(depth int) ([]*Page, error)
+}
+
+func sameHost(a string, b string) bool {
+	ua, err := neturl.Parse(a)
+	if err != nil {
+		return false
+	}
+	ub, err := neturl.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Hostname(), ub.Hostname())
+}
+
+func sortPages(pages []*Page) []*Page {
+	sort.Slice(pages, func(i, j int) bool { return pages[i].URL < pages[j].URL })
+	return pages
+}
+
+func sortEdges(edges []Edge) {
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+}
+
+// orphans returns the `pages` with no inbound links from other pages of the same host
+func orphans(pages map[string]*Page) []*Page {
+	linked := map[string]bool{}
+	for from, p := range pages {
+		for _, l := range p.Links {
+			if l.URL != from && sameHost(from, l.URL) {
+				linked[l.URL] = true
+			}
+		}
+	}
+	found := []*Page{}
+	for u, p := range pages {
+		if !linked[u] {
+			found = append(found, p)
+		}
+	}
+	return sortPages(found)
+}
+
+func atDepth(pages map[string]*Page, depth int) []*Page {
+	found := []*Page{}
+	for _, p := range pages {
+		if p.Depth == depth {
+			found = append(found, p)
+		}
+	}
+	return sortPages(found)
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func urls(pages []*Page) []string {
+	found := []string{}
+	for _, p := range pages {
+		found = append(found, p.URL)
+	}
+	return found
+}
+
+func TestQuerier(t *testing.T) {
+	cfg, cleanup := tempSQLite(t)
+	defer cleanup()
+	sqliteDB, _ := NewStorage("sqlite", cfg)
+	defer sqliteDB.(*sqlite).Close()
+	inMemoryDB, _ := NewStorage("in-memory", Config{})
+
+	pages := append([]*Page{
+		// Only linked from another host
+		{URL: "https://other.com/", StatusCode: 200, Links: []Link{{URL: "https://example.com/lonely", Text: "Lonely"}}},
+		{URL: "https://example.com/lonely", Depth: 1, StatusCode: 200, Links: []Link{{URL: "https://example.com/about-us"}}},
+	}, samplePages...)
+
+	for _, db := range []Storage{inMemoryDB, sqliteDB} {
+		for _, p := range pages {
+			db.Store(p)
+		}
+		q := db.(Querier)
+
+		inbound, err := q.Inbound("https://example.com/about-us")
+		assert.Nil(t, err)
+		assert.Equal(t, []Edge{
+			{From: "https://example.com/", To: "https://example.com/about-us", Text: "About us"},
+			{From: "https://example.com/lonely", To: "https://example.com/about-us"},
+		}, inbound)
+
+		inbound, err = q.Inbound("https://example.com/nowhere")
+		assert.Nil(t, err)
+		assert.Empty(t, inbound)
+
+		orphans, err := q.Orphans()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"https://example.com/", "https://example.com/lonely", "https://other.com/"}, urls(orphans))
+
+		broken, err := q.BrokenLinks()
+		assert.Nil(t, err)
+		assert.Equal(t, []BrokenLink{{
+			Edge:       Edge{From: "https://example.com/", To: "https://example.com/missing"},
+			StatusCode: 404,
+			Error:      "https://example.com/missing returned status code 404",
+		}}, broken)
+
+		deep, err := q.AtDepth(1)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"https://example.com/about-us", "https://example.com/lonely", "https://example.com/missing"}, urls(deep))
+		assert.Equal(t, "https://example.com/about/", deep[0].FinalURL)
+
+		deep, err = q.AtDepth(5)
+		assert.Nil(t, err)
+		assert.Empty(t, deep)
+	}
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	// Registers the sqlite3 driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS pages (
+	url          TEXT PRIMARY KEY,
+	final_url    TEXT,
+	redirects    TEXT,
+	status       INTEGER,
+	depth        INTEGER NOT NULL,
+	content_type TEXT,
+	fetched_at   DATETIME,
+	latency_ns   INTEGER,
+	attempts     INTEGER,
+	content_hash TEXT,
+	noindex      INTEGER NOT NULL DEFAULT 0,
+	skipped      TEXT,
+	error        TEXT
+);
+
+CREATE TABLE IF NOT EXISTS edges (
+	from_url    TEXT NOT NULL,
+	to_url      TEXT NOT NULL,
+	anchor_text TEXT,
+	kind        TEXT,
+	nofollow    INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (from_url, to_url)
+);
+
+CREATE INDEX IF NOT EXISTS edges_to_url ON edges (to_url);
+`
+
+// sqlite stores every page as soon as it is crawled, so the crawl can be queried with SQL
+// while it runs and survives crashes.
+type sqlite struct {
+	db *sql.DB
+}
+
+func newSQLite(path string) (*sqlite, error) {
+	// WAL lets readers query the database while the crawl writes to it
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=off")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, let workers queue in the pool instead of failing with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqlite{db: db}, nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func (s *sqlite) Store(p *Page) error {
+	redirects, err := json.Marshal(p.Redirects)
+	if err != nil {
+		return err
+	}
+	fetchedAt := sql.NullTime{Time: p.FetchedAt, Valid: !p.FetchedAt.IsZero()}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT OR REPLACE INTO pages
+		(url, final_url, redirects, status, depth, content_type, fetched_at, latency_ns, attempts, content_hash, noindex, skipped, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.URL, nullString(p.FinalURL), string(redirects), p.StatusCode, p.Depth, nullString(p.ContentType),
+		fetchedAt, int64(p.Latency), p.Attempts, nullString(p.ContentHash), p.Noindex, nullString(p.Skipped), nullString(p.Error))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// A recrawled page replaces its previous edges
+	if _, err := tx.Exec(`DELETE FROM edges WHERE from_url = ?`, p.URL); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, l := range p.Links {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO edges (from_url, to_url, anchor_text, kind, nofollow) VALUES (?, ?, ?, ?, ?)`, p.URL, l.URL, nullString(l.Text), nullString(l.Kind), l.Nofollow); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// pages reads back every stored page along with its links
+func (s *sqlite) pages() (map[string]*Page, error) {
+	rows, err := s.db.Query(`SELECT url, final_url, redirects, status, depth, content_type, fetched_at, latency_ns, attempts, content_hash, noindex, skipped, error FROM pages`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pages := map[string]*Page{}
+	for rows.Next() {
+		p := &Page{}
+		var finalURL, contentType, contentHash, skipped, errMsg sql.NullString
+		var redirects string
+		var fetchedAt sql.NullTime
+		var latency int64
+		err := rows.Scan(&p.URL, &finalURL, &redirects, &p.StatusCode, &p.Depth, &contentType, &fetchedAt, &latency, &p.Attempts, &contentHash, &p.Noindex, &skipped, &errMsg)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(redirects), &p.Redirects); err != nil {
+			return nil, err
+		}
+		p.FinalURL, p.ContentType, p.ContentHash, p.Skipped, p.Error = finalURL.String, contentType.String, contentHash.String, skipped.String, errMsg.String
+		p.FetchedAt = fetchedAt.Time
+		p.Latency = time.Duration(latency)
+		// Pages that could not be parsed have no links, crawled pages at least an empty list
+		if p.Error == "" && p.Skipped == "" {
+			p.Links = []Link{}
+		}
+		pages[p.URL] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	edges, err := s.db.Query(`SELECT from_url, to_url, anchor_text, kind, nofollow FROM edges ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer edges.Close()
+	for edges.Next() {
+		var from string
+		var l Link
+		var text, kind sql.NullString
+		if err := edges.Scan(&from, &l.URL, &text, &kind, &l.Nofollow); err != nil {
+			return nil, err
+		}
+		l.Text, l.Kind = text.String, kind.String
+		if p, ok := pages[from]; ok {
+			p.Links = append(p.Links, l)
+		}
+	}
+	return pages, edges.Err()
+}
+
+func (s *sqlite) Walk(fn func(p *Page) error) error {
+	pages, err := s.pages()
+	if err != nil {
+		return err
+	}
+	for _, p := range pages {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlite) Inbound(url string) ([]Edge, error) {
+	rows, err := s.db.Query(`SELECT from_url, anchor_text FROM edges WHERE to_url = ? ORDER BY from_url`, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edges := []Edge{}
+	for rows.Next() {
+		e := Edge{To: url}
+		var text sql.NullString
+		if err := rows.Scan(&e.From, &text); err != nil {
+			return nil, err
+		}
+		e.Text = text.String
+		edges = append(edges, e)
+	}
+	return edges, rows.Err()
+}
+
+func (s *sqlite) Orphans() ([]*Page, error) {
+	pages, err := s.pages()
+	if err != nil {
+		return nil, err
+	}
+	return orphans(pages), nil
+}
+
+func (s *sqlite) BrokenLinks() ([]BrokenLink, error) {
+	rows, err := s.db.Query(`SELECT e.from_url, e.to_url, e.anchor_text, p.status, p.error
+		FROM edges e JOIN pages p ON p.url = e.to_url
+		WHERE p.error IS NOT NULL
+		ORDER BY e.from_url, e.to_url`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	broken := []BrokenLink{}
+	for rows.Next() {
+		var b BrokenLink
+		var text sql.NullString
+		if err := rows.Scan(&b.From, &b.To, &text, &b.StatusCode, &b.Error); err != nil {
+			return nil, err
+		}
+		b.Text = text.String
+		broken = append(broken, b)
+	}
+	return broken, rows.Err()
+}
+
+func (s *sqlite) AtDepth(depth int) ([]*Page, error) {
+	pages, err := s.pages()
+	if err != nil {
+		return nil, err
+	}
+	return atDepth(pages, depth), nil
+}
+
+func (s *sqlite) Dump() (string, error) {
+	pages, err := s.pages()
+	if err != nil {
+		return "", err
+	}
+	jsonData, err := json.MarshalIndent(pages, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	return string(jsonData), nil
+}
+
+// Close releases the database file
+func (s *sqlite) Close() error {
+	return s.db.Close()
+}
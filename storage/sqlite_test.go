@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempSQLite(t *testing.T) (Config, func()) {
+	dir, err := ioutil.TempDir("", "wanna-crawl-storage")
+	assert.Nil(t, err)
+	return Config{Path: filepath.Join(dir, "crawl.db")}, func() { os.RemoveAll(dir) }
+}
+
+var samplePages = []*Page{
+	{
+		URL:         "https://example.com/",
+		FinalURL:    "https://example.com/",
+		StatusCode:  200,
+		ContentType: "text/html",
+		FetchedAt:   time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC),
+		Latency:     120 * time.Millisecond,
+		Attempts:    1,
+		ContentHash: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		Links: []Link{
+			{URL: "https://example.com/about-us", Text: "About us", Kind: "a", Nofollow: true},
+			{URL: "https://example.com/missing", Kind: "img"},
+		},
+	},
+	{
+		URL:        "https://example.com/about-us",
+		Depth:      1,
+		FinalURL:   "https://example.com/about/",
+		Redirects:  []string{"https://example.com/about-us"},
+		StatusCode: 200,
+		FetchedAt:  time.Date(2019, 10, 1, 12, 0, 1, 0, time.UTC),
+		Attempts:   1,
+		Noindex:    true,
+		Links:      []Link{},
+	},
+	{
+		URL:        "https://example.com/missing",
+		Depth:      1,
+		StatusCode: 404,
+		FetchedAt:  time.Date(2019, 10, 1, 12, 0, 2, 0, time.UTC),
+		Attempts:   1,
+		Error:      "https://example.com/missing returned status code 404",
+	},
+}
+
+func TestSQLiteSchema(t *testing.T) {
+	cfg, cleanup := tempSQLite(t)
+	defer cleanup()
+
+	db, err := NewStorage("sqlite", cfg)
+	assert.Nil(t, err)
+	defer db.(*sqlite).Close()
+	for _, p := range samplePages {
+		assert.Nil(t, db.Store(p))
+	}
+
+	// Results can be queried with plain SQL while the crawl runs
+	reader, err := sql.Open("sqlite3", cfg.Path)
+	assert.Nil(t, err)
+	defer reader.Close()
+
+	var status, depth int
+	var hash string
+	err = reader.QueryRow(`SELECT status, depth, content_hash FROM pages WHERE url = ?`, "https://example.com/").Scan(&status, &depth, &hash)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, 0, depth)
+	assert.Equal(t, samplePages[0].ContentHash, hash)
+
+	var from, text, kind string
+	var nofollow bool
+	err = reader.QueryRow(`SELECT from_url, anchor_text, kind, nofollow FROM edges WHERE to_url = ?`, "https://example.com/about-us").Scan(&from, &text, &kind, &nofollow)
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/", from)
+	assert.Equal(t, "About us", text)
+	assert.Equal(t, "a", kind)
+	assert.True(t, nofollow)
+
+	var noindex []string
+	rows, err := reader.Query(`SELECT url FROM pages WHERE noindex`)
+	assert.Nil(t, err)
+	for rows.Next() {
+		var url string
+		assert.Nil(t, rows.Scan(&url))
+		noindex = append(noindex, url)
+	}
+	rows.Close()
+	assert.Equal(t, []string{"https://example.com/about-us"}, noindex)
+
+	var broken int
+	err = reader.QueryRow(`SELECT COUNT(*) FROM edges e JOIN pages p ON p.url = e.to_url WHERE p.status >= 400`).Scan(&broken)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, broken)
+}
+
+func TestSQLiteDump(t *testing.T) {
+	cfg, cleanup := tempSQLite(t)
+	defer cleanup()
+
+	db, _ := NewStorage("sqlite", cfg)
+	defer db.(*sqlite).Close()
+	im, _ := NewStorage("in-memory", Config{})
+	for _, p := range samplePages {
+		db.Store(p)
+		im.Store(p)
+	}
+
+	// Same output as the in-memory storage
+	expected, _ := im.Dump()
+	sitemap, err := db.Dump()
+	assert.Nil(t, err)
+	assert.JSONEq(t, expected, sitemap)
+}
+
+func TestSQLiteSkipped(t *testing.T) {
+	cfg, cleanup := tempSQLite(t)
+	defer cleanup()
+
+	db, _ := NewStorage("sqlite", cfg)
+	defer db.(*sqlite).Close()
+	skipped := &Page{
+		URL:         "https://example.com/big.iso",
+		Depth:       1,
+		StatusCode:  200,
+		ContentType: "application/octet-stream",
+		FetchedAt:   time.Date(2019, 10, 1, 12, 0, 3, 0, time.UTC),
+		Attempts:    1,
+		Skipped:     "content type application/octet-stream is not allowed",
+	}
+	assert.Nil(t, db.Store(skipped))
+
+	// Skipped pages were not parsed, so they have no links
+	pages, err := db.(*sqlite).pages()
+	assert.Nil(t, err)
+	assert.Equal(t, skipped, pages["https://example.com/big.iso"])
+}
+
+func TestSQLiteRecrawlReplacesPage(t *testing.T) {
+	cfg, cleanup := tempSQLite(t)
+	defer cleanup()
+
+	db, _ := NewStorage("sqlite", cfg)
+	defer db.(*sqlite).Close()
+	db.Store(samplePages[0])
+	db.Store(&Page{URL: "https://example.com/", StatusCode: 200, Links: []Link{{URL: "https://example.com/new"}}})
+
+	pages, err := db.(*sqlite).pages()
+	assert.Nil(t, err)
+	assert.Len(t, pages, 1)
+	assert.Equal(t, []Link{{URL: "https://example.com/new"}}, pages["https://example.com/"].Links)
+}
+
+func TestSQLiteSurvivesRestarts(t *testing.T) {
+	cfg, cleanup := tempSQLite(t)
+	defer cleanup()
+
+	db, _ := NewStorage("sqlite", cfg)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.Nil(t, db.Store(&Page{URL: fmt.Sprintf("https://example.com/%d", i), StatusCode: 200}))
+		}(i)
+	}
+	wg.Wait()
+	db.(*sqlite).Close()
+
+	db, err := NewStorage("sqlite", cfg)
+	assert.Nil(t, err)
+	defer db.(*sqlite).Close()
+	pages, err := db.(*sqlite).pages()
+	assert.Nil(t, err)
+	assert.Len(t, pages, 50)
+}
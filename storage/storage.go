@@ -1,24 +1,64 @@
 package storage
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"time"
+)
 
 var storageEngines map[string]bool
 
-const inMemoryStorage = "in-memory"
+const (
+	inMemoryStorage = "in-memory"
+	sqliteStorage   = "sqlite"
+	jsonlStorage    = "jsonl"
+)
+
+// Default files of every engine, used when `Config.Path` is empty
+const (
+	defaultSQLitePath = "wanna-crawl.db"
+	defaultJSONLPath  = "-" // stdout
+)
 
 func init() {
 	storageEngines = make(map[string]bool)
 	storageEngines[inMemoryStorage] = true
+	storageEngines[sqliteStorage] = true
+	storageEngines[jsonlStorage] = true
+}
+
+// Config represents storage configuration
+type Config struct {
+	// Database file of the sqlite storage or output file of the jsonl storage, `-` being stdout
+	Path string
+	// How often the jsonl storage flushes buffered records, 0 flushes every record right away
+	FlushInterval time.Duration
+	// Whether the jsonl storage fsyncs its file on every flush
+	Fsync bool
 }
 
 // Storage abstracts different implementation for the crawler results store.
+// Streaming engines write every page as it is stored, and dump nothing.
 type Storage interface {
-	Store(u string, l []string) error
+	Store(p *Page) error
 	Dump() (string, error)
 }
 
+// Persistent is implemented by storages that can be written to a checkpoint and read back from it.
+// Engines that already keep their data outside the process don't need it.
+type Persistent interface {
+	Save(w io.Writer) error
+	Load(r io.Reader) error
+}
+
+// Walker is implemented by storages that can read back the stored pages.
+type Walker interface {
+	// Walk calls `fn` for every stored page, in no particular order, until it returns an error
+	Walk(fn func(p *Page) error) error
+}
+
 // NewStorage returns a `Storage` interface given the Storage `kind` or `error` if it is not supported.
-func NewStorage(kind string) (Storage, error) {
+func NewStorage(kind string, cfg Config) (Storage, error) {
 	if !storageEngines[kind] {
 		return nil, fmt.Errorf("storage engine %s not supported", kind)
 	}
@@ -29,9 +69,31 @@ func NewStorage(kind string) (Storage, error) {
 	switch kind {
 	case inMemoryStorage:
 		im := &inMemory{
-			db: make(map[string][]string),
+			db: make(map[string]*Page),
 		}
 		storage = im
+	case sqliteStorage:
+		var s *sqlite
+		path := cfg.Path
+		if path == "" {
+			path = defaultSQLitePath
+		}
+		s, err = newSQLite(path)
+		if err != nil {
+			return nil, err
+		}
+		storage = s
+	case jsonlStorage:
+		var j *jsonl
+		path := cfg.Path
+		if path == "" {
+			path = defaultJSONLPath
+		}
+		j, err = newJSONL(path, cfg)
+		if err != nil {
+			return nil, err
+		}
+		storage = j
 	}
 	return storage, err
 }
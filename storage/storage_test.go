@@ -2,19 +2,36 @@ package storage
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestNewStorage(t *testing.T) {
-	db, err := NewStorage("in-memory")
+	db, err := NewStorage("in-memory", Config{})
 	assert.Nil(t, err)
 	assert.NotNil(t, db)
 	assert.IsType(t, new(inMemory), db)
 	assert.Implements(t, new(Storage), db)
 
-	notImplementedStorage, err := NewStorage("not-implemented")
+	dir, _ := ioutil.TempDir("", "wanna-crawl-storage")
+	defer os.RemoveAll(dir)
+	sqliteDB, err := NewStorage("sqlite", Config{Path: filepath.Join(dir, "crawl.db")})
+	assert.Nil(t, err)
+	assert.IsType(t, new(sqlite), sqliteDB)
+	assert.Implements(t, new(Storage), sqliteDB)
+	sqliteDB.(*sqlite).Close()
+
+	jsonlDB, err := NewStorage("jsonl", Config{Path: filepath.Join(dir, "crawl.jsonl")})
+	assert.Nil(t, err)
+	assert.IsType(t, new(jsonl), jsonlDB)
+	assert.Implements(t, new(Storage), jsonlDB)
+	jsonlDB.(*jsonl).Close()
+
+	notImplementedStorage, err := NewStorage("not-implemented", Config{})
 	assert.EqualError(t, err, fmt.Sprintf("storage engine %s not supported", "not-implemented"))
 	assert.Nil(t, notImplementedStorage)
 }
@@ -5,14 +5,18 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/fcgravalos/wanna-crawl/crawler"
+	"github.com/fcgravalos/wanna-crawl/export"
 	"github.com/fcgravalos/wanna-crawl/fetcher"
 	"github.com/fcgravalos/wanna-crawl/frontier"
+	"github.com/fcgravalos/wanna-crawl/seeds"
 	"github.com/fcgravalos/wanna-crawl/seen"
 	"github.com/fcgravalos/wanna-crawl/storage"
 	logr "github.com/sirupsen/logrus"
@@ -23,23 +27,92 @@ var version string
 func main() {
 	var frontierCfg frontier.Config
 	var crawlerCfg crawler.Config
+	var seenCfg seen.Config
+	var storageCfg storage.Config
 	var storageEngine string
 	var seenCacheEngine string
 	var seedFile string
 	var logLevel string
 	var printVersion bool
-	var fetcherRequestTimeout time.Duration
+	var compactSeenCache bool
+	var seenHostTTL string
+	var extractKinds string
+	var followKinds string
+	var canonicalRules string
+	var trackingParams string
+	var urlRules string
+	var allowedHosts string
+	var urlRulesFile string
+	var resume bool
+	var fetcherCfg fetcher.Config
+	var sitemapCfg export.SitemapConfig
+	var graphCfg export.GraphConfig
+	var outputFormat string
+	var reportCfg export.ReportConfig
+	var checkLinks bool
+	var seedsCfg seeds.Config
+	var sitemapSeeds string
+	var unreachedFile string
+	var allowedContentTypes string
 
 	flag.BoolVar(&printVersion, "version", false, "Print wanna-crawl version")
-	flag.DurationVar(&fetcherRequestTimeout, "fetcher.request-timeout", 3*time.Second, "HTTP Request connection timeout.")
-	flag.BoolVar(&crawlerCfg.FollowExternalLinks, "crawler.follow-external-links", true, "Whether or not to extract links outside the subdomain of the root url.")
+	flag.DurationVar(&fetcherCfg.RequestTimeout, "fetcher.request-timeout", 3*time.Second, "HTTP Request connection timeout.")
+	flag.StringVar(&fetcherCfg.UserAgent, "fetcher.user-agent", "wanna-crawl", "User-Agent sent on every request and matched against robots.txt groups.")
+	flag.BoolVar(&fetcherCfg.RespectRobots, "fetcher.respect-robots", true, "Whether or not to honor robots.txt rules.")
+	flag.Float64Var(&fetcherCfg.HostRateLimit, "fetcher.host-rate-limit", 2, "Max requests per second sent to a single host, 0 means unlimited.")
+	flag.IntVar(&fetcherCfg.MaxInFlightPerHost, "fetcher.host-max-in-flight", 2, "Max number of concurrent requests to a single host, 0 means unlimited.")
+	flag.IntVar(&fetcherCfg.MaxAttempts, "fetcher.retry-max-attempts", 3, "Max number of times a url is requested on transient failures, 1 disables retries.")
+	flag.DurationVar(&fetcherCfg.RetryBackoff, "fetcher.retry-backoff", 500*time.Millisecond, "Wait before the first retry, doubled on every following attempt.")
+	flag.DurationVar(&fetcherCfg.RetryMaxBackoff, "fetcher.retry-max-backoff", 30*time.Second, "Upper bound for the wait between attempts, 0 means no upper bound. Longer Retry-After headers are cut down to it, or to 5m when there is none.")
+	flag.Int64Var(&fetcherCfg.MaxBodySize, "fetcher.max-body-size", 50*1024*1024, "Max size of a response body in bytes, larger ones are recorded as skipped without being downloaded. 0 means unlimited.")
+	flag.StringVar(&allowedContentTypes, "fetcher.allowed-content-types", "text/html,application/xhtml+xml", "Comma separated media types whose bodies are downloaded, like text/html or text/*, the rest are recorded as skipped. Empty downloads every type.")
+	flag.Float64Var(&fetcherCfg.RetryJitter, "fetcher.retry-jitter", 0.5, "Fraction, between 0 and 1, of the backoff that is randomly shaved off.")
+	flag.StringVar(&crawlerCfg.Scope, "crawler.scope", "all", "Which links are extracted from a page: host, for its own host, domain, for any host under its registrable domain, allowlist, for the -crawler.allowed-hosts, or all.")
+	flag.StringVar(&allowedHosts, "crawler.allowed-hosts", "", "Comma separated hosts links can point to in the allowlist scope, *.example.com allowing any subdomain of example.com.")
+	flag.StringVar(&extractKinds, "crawler.extract", "a", "Comma separated kinds of links to extract: a, area, link, img, script, iframe, form, meta-refresh and css.")
+	flag.StringVar(&canonicalRules, "crawler.canonicalize", "fragment,case,port,sort-query,tracking,encoding,path", "Comma separated rules turning links into their canonical form: fragment, case, port, sort-query, tracking, encoding and path.")
+	flag.StringVar(&trackingParams, "crawler.tracking-params", "utm_*,gclid,fbclid,msclkid,dclid,yclid,mc_cid,mc_eid,_ga,_hsenc,_hsmi", "Comma separated query params dropped by the tracking canonicalization rule, a trailing * matches any suffix.")
+	flag.BoolVar(&crawlerCfg.RespectRelNofollow, "crawler.respect-rel-nofollow", true, "Whether or not to skip following rel=nofollow links.")
+	flag.BoolVar(&crawlerCfg.RespectNofollow, "crawler.respect-nofollow", true, "Whether or not to skip following the links of pages with a nofollow robots meta tag or X-Robots-Tag header.")
+	flag.BoolVar(&crawlerCfg.RespectNoindex, "crawler.respect-noindex", true, "Whether or not to mark pages with a noindex robots meta tag or X-Robots-Tag header as noindex, leaving them out of the sitemap.")
+	flag.StringVar(&urlRules, "crawler.rules", "", "Semicolon separated include and exclude rules links must pass, like \"exclude path /docs/archive/**; include path /docs/**\". The first matching rule wins.")
+	flag.StringVar(&urlRulesFile, "crawler.rules-file", "", "File with one include or exclude rule per line, evaluated after the -crawler.rules ones.")
+	flag.StringVar(&followKinds, "frontier.follow", "a,area,iframe,meta-refresh", "Comma separated kinds of links to crawl, the rest of the extracted ones are only recorded. Empty crawls every kind.")
 	flag.IntVar(&frontierCfg.MaxConcurrency, "frontier.max-concurrency", 8, "Max number of workers attending to crawling jobs.")
-	flag.IntVar(&frontierCfg.MaxDepth, "frontier.max-depth", 2, "The max number of links a single url can  be reached from.")
+	flag.IntVar(&frontierCfg.MaxDepth, "frontier.max-depth", 2, "Max number of links between a seed and a crawled url, links found further away are discarded.")
 	flag.IntVar(&frontierCfg.MaxPoolSize, "frontier.max-pool-size", 4, "Max number of frontier servers that can be started concurrently.")
 	flag.IntVar(&frontierCfg.PublishQueueSize, "frontier.publish-queue-size", 1024, "Size for the queue where workers will store results.")
-	flag.StringVar(&storageEngine, "storage.engine", "in-memory", "Storage engine to use to ingest crawling results.")
+	flag.StringVar(&frontierCfg.CheckpointDir, "frontier.checkpoint-dir", "", "Directory where the crawl state is periodically saved. Empty disables checkpoints.")
+	flag.DurationVar(&frontierCfg.CheckpointInterval, "frontier.checkpoint-interval", 1*time.Minute, "How often the crawl state is saved.")
+	flag.BoolVar(&resume, "resume", false, "Resume the crawl saved in -frontier.checkpoint-dir instead of starting from the seeds file.")
+	flag.StringVar(&storageEngine, "storage.engine", "in-memory", "Storage engine to use to ingest crawling results: in-memory, sqlite or jsonl.")
+	flag.StringVar(&storageCfg.Path, "storage.path", "", "Database file of the sqlite storage, wanna-crawl.db by default, or output file of the jsonl storage, stdout by default.")
+	flag.DurationVar(&storageCfg.FlushInterval, "storage.flush-interval", 0, "How often the jsonl storage flushes its output, 0 flushes every record.")
+	flag.BoolVar(&storageCfg.Fsync, "storage.fsync", false, "Fsync the jsonl storage file on every flush.")
 	flag.StringVar(&seenCacheEngine, "seen_cache.engine", "in-memory", "Seen cache engine to use to track already seen urls.")
-	flag.StringVar(&seedFile, "seeds.file", "seeds.txt", "Source for seed urls")
+	flag.Uint64Var(&seenCfg.ExpectedItems, "seen_cache.expected-items", 1000000, "Number of urls the bloom seen cache is sized for.")
+	flag.Float64Var(&seenCfg.FalsePositiveRate, "seen_cache.false-positive-rate", 0.01, "Accepted rate of never seen urls reported as seen by the bloom seen cache.")
+	flag.StringVar(&seenCfg.Path, "seen_cache.path", "seen.db", "Database file of the disk seen cache.")
+	flag.BoolVar(&compactSeenCache, "seen_cache.compact", false, "Compact the seen cache before crawling, if the engine supports it.")
+	flag.StringVar(&seenCfg.RedisURL, "seen_cache.redis-url", "redis://localhost:6379/0", "Redis server of the redis seen cache.")
+	flag.StringVar(&seenCfg.RedisPrefix, "seen_cache.redis-prefix", "wanna-crawl", "Prefix of the redis seen cache keys, crawls sharing a prefix share the seen set.")
+	flag.IntVar(&seenCfg.RedisPoolSize, "seen_cache.redis-pool-size", 16, "Max number of connections to Redis.")
+	flag.DurationVar(&seenCfg.TTL, "seen_cache.ttl", 0, "How long a url stays seen before it can be crawled again, 0 means forever.")
+	flag.StringVar(&seenHostTTL, "seen_cache.host-ttl", "", "Per host overrides of -seen_cache.ttl, like example.com=1h,blog.example.com=24h.")
+	flag.StringVar(&outputFormat, "export.format", "json", "Format the crawling results are printed in once the crawl ends: json, dot or graphml.")
+	flag.BoolVar(&graphCfg.CollapseExternal, "export.collapse-external-hosts", false, "Show every external host as a single node in dot and graphml outputs.")
+	flag.StringVar(&sitemapCfg.Dir, "export.sitemap-dir", "", "Directory where the XML sitemap of the crawled site is written once the crawl ends. Empty disables it.")
+	flag.StringVar(&sitemapCfg.BaseURL, "export.sitemap-base-url", "", "Where the sitemap files will be served from, used by the sitemap index. Defaults to the root of the first seed.")
+	flag.BoolVar(&sitemapCfg.Gzip, "export.sitemap-gzip", false, "Gzip the sitemap files.")
+	flag.BoolVar(&checkLinks, "check-links", false, "Check every link found, crawling only the pages in the -crawler.scope of the seeds, host unless set, print the broken ones and exit with status 2 if there are any.")
+	flag.StringVar(&reportCfg.Kind, "report", "", "Print a report instead of the crawling results: inbound, orphans, broken-links or depth.")
+	flag.StringVar(&reportCfg.URL, "report.url", "", "Url whose inbound links are reported by -report inbound.")
+	flag.IntVar(&reportCfg.Depth, "report.depth", 0, "Depth whose pages are reported by -report depth.")
+	flag.StringVar(&seedFile, "seeds.file", "seeds.txt", "Source for seed urls, empty crawls nothing, to report on the results of a previous crawl.")
+	flag.BoolVar(&seedsCfg.Robots, "seeds.robots-sitemaps", false, "Add the urls listed in the sitemaps of the robots.txt of every seed host to the seeds.")
+	flag.StringVar(&sitemapSeeds, "seeds.sitemaps", "", "Comma separated sitemap or sitemap index urls whose urls are added to the seeds.")
+	flag.IntVar(&seedsCfg.MaxURLs, "seeds.sitemap-max-urls", 0, "Max number of urls added to the seeds from sitemaps, 0 means unlimited.")
+	flag.StringVar(&unreachedFile, "seeds.unreached-file", "sitemap-unreached.txt", "File where the sitemap urls no crawled page links to are written once the crawl ends. Empty disables it.")
 	flag.StringVar(&logLevel, "log.level", "error", "Logging level: error, warning, info or debug")
 	flag.Parse()
 
@@ -48,20 +121,101 @@ func main() {
 		fmt.Printf("Wanna Crawl %s\n", version)
 		os.Exit(0)
 	}
-	// Read seeds from seedFile
-	fd, err := os.Open(seedFile)
+	switch outputFormat {
+	case "json", "dot", "graphml":
+	default:
+		fmt.Fprintf(os.Stderr, "Output format %s not supported\n", outputFormat)
+		os.Exit(1)
+	}
+	if reportCfg.Kind != "" {
+		if err := export.ValidReport(reportCfg.Kind); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if allowedContentTypes != "" {
+		fetcherCfg.AllowedContentTypes = strings.Split(allowedContentTypes, ",")
+	}
+	if err := crawler.ValidScope(crawlerCfg.Scope); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if allowedHosts != "" {
+		crawlerCfg.AllowedHosts = strings.Split(allowedHosts, ",")
+	}
+	if crawlerCfg.Scope == crawler.ScopeAllowlist && len(crawlerCfg.AllowedHosts) == 0 {
+		fmt.Fprintln(os.Stderr, "-crawler.scope allowlist requires -crawler.allowed-hosts")
+		os.Exit(1)
+	}
+	extract, err := crawler.ParseKinds(extractKinds)
 	if err != nil {
-		fmt.Printf("Failed to read seed file %s: %v\n", seedFile, err)
+		fmt.Fprintf(os.Stderr, "Failed to parse -crawler.extract: %v\n", err)
 		os.Exit(1)
 	}
-
-	scanner := bufio.NewScanner(fd)
-	seeds := []string{}
-	for scanner.Scan() {
-		seeds = append(seeds, scanner.Text())
+	crawlerCfg.Extract = extract
+	follow, err := crawler.ParseKinds(followKinds)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse -frontier.follow: %v\n", err)
+		os.Exit(1)
+	}
+	frontierCfg.Follow = follow
+	canonical, err := crawler.ParseCanonicalConfig(canonicalRules, trackingParams)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse -crawler.canonicalize: %v\n", err)
+		os.Exit(1)
+	}
+	crawlerCfg.Canonical = canonical
+	rules, err := crawler.ParseRules(strings.NewReader(strings.Replace(urlRules, ";", "\n", -1)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse -crawler.rules: %v\n", err)
+		os.Exit(1)
+	}
+	if urlRulesFile != "" {
+		fd, err := os.Open(urlRulesFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read rules file %s: %v\n", urlRulesFile, err)
+			os.Exit(1)
+		}
+		fileRules, err := crawler.ParseRules(fd)
+		fd.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse -crawler.rules-file: %v\n", err)
+			os.Exit(1)
+		}
+		rules = append(rules, fileRules...)
+	}
+	crawlerCfg.Rules = rules
+	if checkLinks {
+		// Links out of scope must be extracted to be checked
+		crawlerCfg.ExtractOutOfScope = true
+		scopeSet := false
+		flag.Visit(func(f *flag.Flag) { scopeSet = scopeSet || f.Name == "crawler.scope" })
+		if !scopeSet {
+			crawlerCfg.Scope = crawler.ScopeHost
+		}
+		frontierCfg.CheckLinks = true
+	}
+	if resume && frontierCfg.CheckpointDir == "" {
+		fmt.Fprintln(os.Stderr, "-resume requires -frontier.checkpoint-dir")
+		os.Exit(1)
 	}
 
-	fd.Close()
+	// Read seeds from seedFile, resumed crawls take them from the checkpoint
+	seedList := []string{}
+	if !resume && seedFile != "" {
+		fd, err := os.Open(seedFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read seed file %s: %v\n", seedFile, err)
+			os.Exit(1)
+		}
+
+		scanner := bufio.NewScanner(fd)
+		for scanner.Scan() {
+			seedList = append(seedList, scanner.Text())
+		}
+
+		fd.Close()
+	}
 
 	// Create wanna-crawl components objects
 	ctx, cancel := context.WithCancel(context.Background())
@@ -69,7 +223,8 @@ func main() {
 	var log logr.Logger
 	log.SetFormatter(&logr.JSONFormatter{})
 	log.SetReportCaller(true)
-	log.SetOutput(os.Stdout)
+	// Stdout is for the crawl results
+	log.SetOutput(os.Stderr)
 	switch logLevel {
 	case "error":
 		log.SetLevel(logr.ErrorLevel)
@@ -83,34 +238,163 @@ func main() {
 		log.SetLevel(logr.ErrorLevel)
 	}
 
-	db, _ := storage.NewStorage(storageEngine)
-	seenCache, _ := seen.NewCache(seenCacheEngine)
+	db, err := storage.NewStorage(storageEngine, storageCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create storage: %v\n", err)
+		os.Exit(1)
+	}
+	hostTTL, err := seen.ParseHostTTL(seenHostTTL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse -seen_cache.host-ttl: %v\n", err)
+		os.Exit(1)
+	}
+	seenCfg.HostTTL = hostTTL
+	seenCache, err := seen.NewCache(seenCacheEngine, seenCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create seen cache: %v\n", err)
+		os.Exit(1)
+	}
+	if c, ok := seenCache.(seen.Compactor); ok && compactSeenCache {
+		if err := c.Compact(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to compact seen cache: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
-	c := crawler.NewCrawler(fetcher.NewHTTPFetcher(ctx, &log, fetcherRequestTimeout), &log, crawlerCfg)
+	fetch, err := fetcher.NewHTTPFetcher(ctx, &log, fetcherCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create fetcher: %v\n", err)
+		os.Exit(1)
+	}
+	c := crawler.NewCrawler(fetch, &log, crawlerCfg)
 	f := frontier.NewFrontier(ctx, seenCache, db, c, &log, frontierCfg)
 
+	// Urls found in sitemaps are crawled as seeds too
+	var sitemapURLs []string
+	if sitemapSeeds != "" {
+		seedsCfg.Sitemaps = strings.Split(sitemapSeeds, ",")
+	}
+	if !resume && (seedsCfg.Robots || len(seedsCfg.Sitemaps) > 0) {
+		// Sharing `fetch` with the crawler keeps sitemap requests within the same per host limits
+		sitemapURLs, err = seeds.NewSitemapDiscoverer(ctx, fetch, &log, seedsCfg).Discover(seedList)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read sitemaps: %v\n", err)
+			os.Exit(1)
+		}
+		log.Infof("found %d urls in sitemaps", len(sitemapURLs))
+		for i, u := range sitemapURLs {
+			sitemapURLs[i] = c.Canonicalize(u)
+		}
+	}
+	for i, seed := range seedList {
+		seedList[i] = c.Canonicalize(seed)
+	}
+	seedList = append(seedList, sitemapURLs...)
+
 	done := make(chan struct{}, 1)
 	sig := make(chan os.Signal, 1)
 
 	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGABRT)
 
-	go f.StartManager(seeds, done)
+	if resume {
+		state, err := f.Restore()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to resume crawl from %s: %v\n", frontierCfg.CheckpointDir, err)
+			os.Exit(1)
+		}
+		go f.ResumeManager(state, done)
+	} else {
+		go f.StartManager(seedList, done)
+	}
+
+	if frontierCfg.CheckpointDir != "" {
+		go f.StartCheckpointing()
+	}
+
+	select {
+	case <-done:
+	case <-sig:
+		cancel()
+		// canceling will make all frontiers to send to the done channel too
+		<-done
+	}
+
+	// Save where we stopped, so an interrupted crawl can be resumed
+	if frontierCfg.CheckpointDir != "" {
+		if err := f.Checkpoint(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to save checkpoint: %v\n", err)
+		}
+	}
+	if r, ok := seenCache.(seen.Reporter); ok {
+		stats := r.Stats()
+		log.WithFields(logr.Fields{
+			"items":               stats.Items,
+			"fill_ratio":          stats.FillRatio,
+			"false_positive_rate": stats.FalsePositiveRate,
+		}).Info("seen cache stats")
+	}
+
+	if sitemapCfg.Dir != "" {
+		files, err := export.Sitemap(db, sitemapCfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export sitemap: %v\n", err)
+		} else {
+			log.Infof("sitemap written to %s", strings.Join(files, ", "))
+		}
+	}
 
-	for {
-		select {
-		case <-done:
-			break
-		case <-sig:
-			cancel()
-			// canceling will make all frontiers to send to the done channel too
+	if len(sitemapURLs) > 0 && unreachedFile != "" {
+		// Sitemap urls are seeds, those no page links to could only be reached through the sitemap
+		var n int
+		fd, err := os.Create(unreachedFile)
+		if err == nil {
+			n, err = export.Unreached(db, fd, sitemapURLs)
+			if closeErr := fd.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write unreached sitemap urls: %v\n", err)
+		} else {
+			log.Infof("%d sitemap urls are not linked from any page, written to %s", n, unreachedFile)
+		}
+	}
+
+	if c, ok := seenCache.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Errorf("failed to close seen cache: %v", err)
+		}
+	}
+
+	// Print sitemap, or the report asked for, streaming storages have already written it
+	broken := 0
+	switch {
+	case checkLinks:
+		broken, err = export.BrokenLinks(db, os.Stdout)
+	case reportCfg.Kind != "":
+		err = export.Report(db, os.Stdout, reportCfg)
+	case outputFormat == "dot":
+		err = export.DOT(db, os.Stdout, graphCfg)
+	case outputFormat == "graphml":
+		err = export.GraphML(db, os.Stdout, graphCfg)
+	default:
+		var sitemap string
+		sitemap, err = db.Dump()
+		if err == nil && sitemap != "" {
+			fmt.Println(sitemap)
 		}
-		break
 	}
-	// Print sitemap
-	sitemap, err := db.Dump()
 	if err != nil {
-		fmt.Printf("failed to print sitemap")
+		fmt.Fprintf(os.Stderr, "failed to print sitemap: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Println(sitemap)
+
+	if c, ok := db.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Errorf("failed to close storage: %v", err)
+		}
+	}
+	if broken > 0 {
+		os.Exit(2)
+	}
 }